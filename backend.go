@@ -2,12 +2,14 @@ package keycloak
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
 
 	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/salt"
 	"github.com/hashicorp/vault/sdk/logical"
 
 	log "github.com/hashicorp/go-hclog"
@@ -20,8 +22,27 @@ type backend struct {
 
 	logger log.Logger
 
-	jwtMutex sync.Mutex
-	jwt      map[ConnectionConfig]*keycloak.JWT
+	// jwtMutex guards jwt and loginMutexes, but is not held during logins
+	jwtMutex     sync.Mutex
+	jwt          map[connectionKey]cachedToken
+	loginMutexes map[connectionKey]*sync.Mutex
+
+	endpointsMutex sync.Mutex
+	endpoints      map[string]*keycloak.Endpoints
+
+	loginStatusMutex sync.Mutex
+	loginStatus      map[connectionKey]loginStatus
+
+	saltMutex sync.Mutex
+	salt      *salt.Salt
+
+	// rotateRootMutex serializes rotations of the connections' secrets
+	// with writes and deletes of the connections
+	rotateRootMutex    sync.Mutex
+	rotationRetryMutex sync.Mutex
+	rotationRetries    map[string]*rotationRetry
+
+	staticRoleMutex sync.Mutex
 }
 
 var _ logical.Factory = Factory
@@ -47,21 +68,31 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 func newBackend(conf *logical.BackendConfig) (*backend, error) {
 
 	b := &backend{
-		jwt: make(map[ConnectionConfig]*keycloak.JWT),
+		jwt:             make(map[connectionKey]cachedToken),
+		loginMutexes:    make(map[connectionKey]*sync.Mutex),
+		endpoints:       make(map[string]*keycloak.Endpoints),
+		loginStatus:     make(map[connectionKey]loginStatus),
+		rotationRetries: make(map[string]*rotationRetry),
 	}
 
 	b.Backend = &framework.Backend{
 		Help:        strings.TrimSpace(keycloakHelp),
 		BackendType: logical.TypeLogical,
 		PathsSpecial: &logical.Paths{
-			SealWrapStorage: []string{
-				"config/connection",
-			},
+			Unauthenticated: jwksPaths,
+			SealWrapStorage: sealWrappedStorage,
 		},
 
 		Paths: framework.PathAppend(
 			b.paths(),
 		),
+		Secrets: []*framework.Secret{
+			secretClient(b),
+			secretUser(b),
+		},
+		InitializeFunc: b.initialize,
+		Invalidate:     b.invalidate,
+		PeriodicFunc:   b.periodicFunc,
 	}
 	b.KeycloakServiceFactory = keycloak.NewGocloakClient
 	b.logger = conf.Logger
@@ -72,13 +103,56 @@ func (b *backend) paths() []*framework.Path {
 	return []*framework.Path{
 		pathConfigConnection(b),
 		pathConfigConnectionOfRealm(b),
+		pathConfigConnectionJwks(b),
+		pathConfigConnectionJwksOfRealm(b),
+		pathConfigRealms(b),
+		pathConfigRotateRoot(b),
+		pathConfigRotateRootOfRealm(b),
 		pathClientSecretDeprecated(b),
 		pathClientSecret(b),
 		pathRealmClientSecret(b),
 		pathRealmClientOptionalSecret(b),
+		pathRealmOpenidConfiguration(b),
+		pathClientRotateSecret(b),
+		pathRealmClientRotateSecret(b),
+		pathClientInvalidateRotatedSecret(b),
+		pathRealmClientInvalidateRotatedSecret(b),
+		pathRealmClientToken(b),
+		pathRealmTokenExchange(b),
+		pathRoles(b),
+		pathRole(b),
+		pathCreds(b),
+		pathUserRoles(b),
+		pathUserRole(b),
+		pathUserCreds(b),
+		pathStaticRoles(b),
+		pathStaticRole(b),
+		pathStaticCreds(b),
+		pathConfigConnections(b),
+		pathConfigNamedConnection(b),
+		pathConfigNamedConnectionRotateRoot(b),
+		pathConfigNamedConnectionJwks(b),
+		withConnection(pathRealmClientSecret(b)),
+		withConnection(pathRealmClientOptionalSecret(b)),
+		withConnection(pathRealmOpenidConfiguration(b)),
+		withConnection(pathRealmClientRotateSecret(b)),
+		withConnection(pathRealmClientInvalidateRotatedSecret(b)),
+		withConnection(pathRealmClientToken(b)),
+		withConnection(pathRealmTokenExchange(b)),
 	}
 }
 
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	if !b.WriteSafeReplicationState() {
+		return nil
+	}
+
+	return errors.Join(
+		b.rotateDueRootCredentials(ctx, req.Storage),
+		b.rotateDueStaticRoles(ctx, req.Storage),
+	)
+}
+
 const keycloakHelp = `
 The Keycloak backend is retrieves secrets from keycloak.
 `
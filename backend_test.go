@@ -373,15 +373,17 @@ func testAccStepReadConfig(t *testing.T, server_url, realm, client_id, client_se
 	require.NoError(t, err)
 
 	var d struct {
-		Realm        string `mapstructure:"realm"`
-		ServerUrl    string `mapstructure:"server_url"`
-		ClientId     string `mapstructure:"client_id"`
-		ClientSecret string `mapstructure:"client_secret"`
+		Realm                   string `mapstructure:"realm"`
+		ServerUrl               string `mapstructure:"server_url"`
+		ClientId                string `mapstructure:"client_id"`
+		ClientSecretFingerprint string `mapstructure:"client_secret_fingerprint"`
 	}
 	err = mapstructure.Decode(res.Data, &d)
 	require.NoError(t, err, "should not error on decode")
 
-	require.Equalf(t, client_secret, d.ClientSecret, "secret was not as expected: %s", d.ClientSecret)
+	require.NotContains(t, res.Data, "client_secret", "the client secret must not be returned")
+	require.NotEmpty(t, d.ClientSecretFingerprint, "fingerprint of the secret is missing")
+	require.NotContains(t, d.ClientSecretFingerprint, client_secret, "fingerprint reveals the secret")
 	require.Equalf(t, client_id, d.ClientId, "id was not as expected: %s", d.ClientId)
 	require.Equalf(t, server_url, d.ServerUrl, "server_url was not as expected: %s", d.ServerUrl)
 	require.Equalf(t, realm, d.Realm, "secret was not as expected: %s", d.Realm)
@@ -400,15 +402,17 @@ func testAccStepReadConfigForRealm(t *testing.T, server_url, realm, client_id, c
 	require.NoError(t, err)
 
 	var d struct {
-		Realm        string `mapstructure:"realm"`
-		ServerUrl    string `mapstructure:"server_url"`
-		ClientId     string `mapstructure:"client_id"`
-		ClientSecret string `mapstructure:"client_secret"`
+		Realm                   string `mapstructure:"realm"`
+		ServerUrl               string `mapstructure:"server_url"`
+		ClientId                string `mapstructure:"client_id"`
+		ClientSecretFingerprint string `mapstructure:"client_secret_fingerprint"`
 	}
 	err = mapstructure.Decode(res.Data, &d)
 	require.NoError(t, err, "should not error on decode")
 
-	require.Equalf(t, client_secret, d.ClientSecret, "secret was not as expected: %s", d.ClientSecret)
+	require.NotContains(t, res.Data, "client_secret", "the client secret must not be returned")
+	require.NotEmpty(t, d.ClientSecretFingerprint, "fingerprint of the secret is missing")
+	require.NotContains(t, d.ClientSecretFingerprint, client_secret, "fingerprint reveals the secret")
 	require.Equalf(t, client_id, d.ClientId, "id was not as expected: %s", d.ClientId)
 	require.Equalf(t, server_url, d.ServerUrl, "server_url was not as expected: %s", d.ServerUrl)
 	require.Equalf(t, realm, d.Realm, "secret was not as expected: %s", d.Realm)
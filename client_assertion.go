@@ -0,0 +1,222 @@
+package keycloak
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/google/uuid"
+	"github.com/hashicorp/vault/sdk/helper/pluginutil"
+)
+
+const (
+	authMethodClientSecret     = "client_secret"
+	authMethodClientJWT        = "client_jwt"
+	authMethodWorkloadIdentity = "workload_identity"
+	authMethodPassword         = "password"
+
+	// adminClientID is the client that logs in users for auth method password.
+	adminClientID = "admin-cli"
+
+	// clientAssertionTTL is the lifetime of the JWTs that vault signs to log in.
+	clientAssertionTTL = time.Minute
+)
+
+// authMethod returns how vault logs in with the connection's client.
+// Connections stored before auth methods existed use the client secret.
+func (c ConnectionConfig) authMethod() string {
+	if c.AuthMethod == "" {
+		return authMethodClientSecret
+	}
+	return c.AuthMethod
+}
+
+// generatePrivateKey creates a key for signing client assertions, encoded as
+// PKCS #8 PEM.
+func generatePrivateKey() (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// parsePrivateKey decodes a PEM encoded RSA or ECDSA key and returns it along
+// with the algorithm that signs with it.
+func parsePrivateKey(pemKey string) (crypto.Signer, jose.SignatureAlgorithm, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, "", errors.New("private_key is not PEM encoded")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse private_key: %w", err)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return key, jose.RS256, nil
+	case *ecdsa.PrivateKey:
+		switch key.Curve.Params().BitSize {
+		case 256:
+			return key, jose.ES256, nil
+		case 384:
+			return key, jose.ES384, nil
+		case 521:
+			return key, jose.ES512, nil
+		}
+	}
+	return nil, "", errors.New("private_key must be an RSA or ECDSA key")
+}
+
+// keyID derives the id of public in the same way as keycloak does for
+// imported keys, so that both sides agree on it.
+func keyID(public crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(hash[:]), nil
+}
+
+// publicKey returns the public part of the connection's private key as JWK.
+func (c ConnectionConfig) publicKey() (jose.JSONWebKey, error) {
+	signer, algorithm, err := parsePrivateKey(c.PrivateKey)
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	kid, err := keyID(signer.Public())
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	return jose.JSONWebKey{
+		Key:       signer.Public(),
+		KeyID:     kid,
+		Algorithm: string(algorithm),
+		Use:       "sig",
+	}, nil
+}
+
+// publicKeyPEM returns the public part of the connection's private key, which
+// can be imported in keycloak.
+func (c ConnectionConfig) publicKeyPEM() (string, error) {
+	jwk, err := c.publicKey()
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKIXPublicKey(jwk.Key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// clientAssertion returns a JWT that authenticates the client of config: for
+// auth method client_jwt signed by its private key, for workload_identity a
+// plugin identity token signed by vault.
+func (b *backend) clientAssertion(ctx context.Context, config ConnectionConfig) (string, error) {
+	if config.authMethod() != authMethodWorkloadIdentity {
+		assertion, err := config.signClientAssertion()
+		if err != nil {
+			return "", fmt.Errorf("failed to sign client assertion: %w", err)
+		}
+		return assertion, nil
+	}
+
+	resp, err := b.System().GenerateIdentityToken(ctx, &pluginutil.IdentityTokenRequest{
+		Audience: config.IdentityTokenAudience,
+		TTL:      config.IdentityTokenTTL,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate plugin identity token: %w", err)
+	}
+	return resp.Token.Token(), nil
+}
+
+// signClientAssertion signs a JWT that authenticates the connection's client
+// with keycloak's "Signed JWT" client authenticator.
+func (c ConnectionConfig) signClientAssertion() (string, error) {
+	signer, algorithm, err := parsePrivateKey(c.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	kid, err := keyID(signer.Public())
+	if err != nil {
+		return "", err
+	}
+
+	joseSigner, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: algorithm, Key: signer},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader(jose.HeaderKey("kid"), kid),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	// keycloak checks the audience against the issuer and token endpoint of
+	// the realm as seen from its frontend, not against admin_url
+	issuer := strings.TrimSuffix(c.ServerUrl, "/") + "/realms/" + c.Realm
+	now := time.Now()
+	claims := jwt.Claims{
+		Issuer:    c.ClientId,
+		Subject:   c.ClientId,
+		Audience:  jwt.Audience{issuer, issuer + "/protocol/openid-connect/token"},
+		ID:        uuid.NewString(),
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		Expiry:    jwt.NewNumericDate(now.Add(clientAssertionTTL)),
+	}
+	return jwt.Signed(joseSigner).Claims(claims).Serialize()
+}
+
+// authenticate adds the credentials of the connection's client to options.
+func (b *backend) authenticate(ctx context.Context, config ConnectionConfig, options *keycloak.TokenOptions) error {
+	clientId := config.ClientId
+	options.ClientID = &clientId
+
+	switch config.authMethod() {
+	case authMethodClientSecret:
+		clientSecret := config.ClientSecret
+		options.ClientSecret = &clientSecret
+		return nil
+	case authMethodPassword:
+		return fmt.Errorf("the client of a connection with auth_method %s has no credentials", authMethodPassword)
+	}
+
+	assertion, err := b.clientAssertion(ctx, config)
+	if err != nil {
+		return err
+	}
+	assertionType := keycloak.ClientAssertionTypeJWTBearer
+	options.ClientAssertionType = &assertionType
+	options.ClientAssertion = &assertion
+	return nil
+}
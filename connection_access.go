@@ -0,0 +1,182 @@
+package keycloak
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/ryanuber/go-glob"
+)
+
+// defaultDeniedClientIds are the clients that keycloak creates in every realm.
+// Their secrets, if any, grant access to keycloak itself rather than to an app.
+var defaultDeniedClientIds = []string{
+	"account",
+	"account-console",
+	"admin-cli",
+	"broker",
+	"realm-management",
+	"security-admin-console",
+}
+
+// accessFields describe which realms and clients a connection serves.
+func accessFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"allowed_realms": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "Glob patterns of the realms that the connection serves. Defaults to all realms",
+		},
+		"allowed_client_ids": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "Glob patterns of the clients that the connection serves. Defaults to all clients",
+		},
+		"require_client_attribute": {
+			Type:        framework.TypeString,
+			Description: "Attribute, as name=value, that clients must have in keycloak to be served, e.g. vault.managed=true. Defaults to none",
+		},
+		"denied_client_ids": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "Glob patterns of the clients that the connection never serves, even if allowed. Defaults to the built-in clients of keycloak, like admin-cli, broker and realm-management",
+		},
+	}
+}
+
+// AccessConfig restricts the realms and clients that a connection serves.
+type AccessConfig struct {
+	AllowedRealms    []string `json:"allowed_realms"`
+	AllowedClientIds []string `json:"allowed_client_ids"`
+	// DeniedClientIds is nil unless configured, which denies the
+	// defaultDeniedClientIds. An empty list denies no client.
+	DeniedClientIds []string `json:"denied_client_ids"`
+	// RequireClientAttribute is the name=value of an attribute that clients
+	// must carry, so that realm admins decide which clients vault exposes.
+	RequireClientAttribute string `json:"require_client_attribute"`
+}
+
+// parseAccessFields merges the access fields of data into c.
+func (c *AccessConfig) parseAccessFields(data *framework.FieldData) {
+	if allowedRealms, ok := data.GetOk("allowed_realms"); ok {
+		c.AllowedRealms = allowedRealms.([]string)
+	}
+	if allowedClientIds, ok := data.GetOk("allowed_client_ids"); ok {
+		c.AllowedClientIds = allowedClientIds.([]string)
+	}
+	if deniedClientIds, ok := data.GetOk("denied_client_ids"); ok {
+		c.DeniedClientIds = append([]string{}, deniedClientIds.([]string)...)
+	}
+	if requireClientAttribute, ok := data.GetOk("require_client_attribute"); ok {
+		c.RequireClientAttribute = requireClientAttribute.(string)
+	}
+}
+
+// validateAccess reports restrictions that cannot be enforced.
+func (c AccessConfig) validateAccess() error {
+	if c.RequireClientAttribute != "" {
+		if name, _, ok := strings.Cut(c.RequireClientAttribute, "="); !ok || name == "" {
+			return errors.New("require_client_attribute must be given as name=value")
+		}
+	}
+	return nil
+}
+
+func (c AccessConfig) deniedClientIds() []string {
+	if c.DeniedClientIds == nil {
+		return defaultDeniedClientIds
+	}
+	return c.DeniedClientIds
+}
+
+// addAccessData describes the restrictions that differ from the defaults.
+func (c AccessConfig) addAccessData(data map[string]interface{}) {
+	if len(c.AllowedRealms) > 0 {
+		data["allowed_realms"] = c.AllowedRealms
+	}
+	if len(c.AllowedClientIds) > 0 {
+		data["allowed_client_ids"] = c.AllowedClientIds
+	}
+	if c.DeniedClientIds != nil {
+		data["denied_client_ids"] = c.DeniedClientIds
+	}
+	if c.RequireClientAttribute != "" {
+		data["require_client_attribute"] = c.RequireClientAttribute
+	}
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if glob.Glob(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRealm reports an error if the connection must not serve realm.
+func (c AccessConfig) checkRealm(realm string) error {
+	if len(c.AllowedRealms) > 0 && !matchesAny(c.AllowedRealms, realm) {
+		return fmt.Errorf("realm %s is not allowed for this connection", realm)
+	}
+	return nil
+}
+
+// checkClient reports an error if the connection must not serve clientId of realm.
+func (c AccessConfig) checkClient(realm string, clientId string) error {
+	if err := c.checkRealm(realm); err != nil {
+		return err
+	}
+	if len(c.AllowedClientIds) > 0 && !matchesAny(c.AllowedClientIds, clientId) {
+		return fmt.Errorf("client %s is not allowed for this connection", clientId)
+	}
+	if matchesAny(c.deniedClientIds(), clientId) {
+		return fmt.Errorf("client %s is denied for this connection", clientId)
+	}
+	return nil
+}
+
+// checkClientRoles reports an error if the connection must not serve the
+// client of one of clientRoles, given as <client-id>/<role>, so that roles of
+// denied clients like realm-management/realm-admin are never granted.
+func (c AccessConfig) checkClientRoles(realm string, clientRoles []string) error {
+	for _, clientRole := range clientRoles {
+		clientId, _, _ := strings.Cut(clientRole, "/")
+		if err := c.checkClient(realm, clientId); err != nil {
+			return fmt.Errorf("client role %s cannot be granted: %w", clientRole, err)
+		}
+	}
+	return nil
+}
+
+// checkClientAttribute reports an error if client, which has the
+// clientId, lacks the attribute that the connection requires. Unlike the
+// other checks, it needs the client as returned by keycloak.
+func (c AccessConfig) checkClientAttribute(clientId string, client *keycloak.Client) error {
+	if c.RequireClientAttribute == "" {
+		return nil
+	}
+	name, value, _ := strings.Cut(c.RequireClientAttribute, "=")
+	if client.Attributes == nil || (*client.Attributes)[name] != value {
+		return fmt.Errorf("%w: client %s is not managed by vault, it lacks the attribute %s", logical.ErrPermissionDenied, clientId, c.RequireClientAttribute)
+	}
+	return nil
+}
+
+// clientErrorResponse responds to a failed call for a client with message,
+// unless the client must not be served, which is reported as is.
+func clientErrorResponse(message string, err error) (*logical.Response, error) {
+	if errors.Is(err, logical.ErrPermissionDenied) {
+		return accessDenied(err)
+	}
+	return logical.ErrorResponse(message), err
+}
+
+// accessDenied responds to requests for realms or clients that the
+// connection must not serve.
+func accessDenied(err error) (*logical.Response, error) {
+	if errors.Is(err, logical.ErrPermissionDenied) {
+		return logical.ErrorResponse(err.Error()), err
+	}
+	return logical.ErrorResponse(err.Error()), logical.ErrPermissionDenied
+}
@@ -0,0 +1,269 @@
+package keycloak
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	testutil "github.com/Serviceware/vault-plugin-secrets-keycloak/util/test"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// mockedFailoverFactory returns the service of the requested url.
+func mockedFailoverFactory(services map[string]keycloak.Service) keycloak.ServiceFactoryFunc {
+	return func(serverUrl string, _ keycloak.ServiceOptions) (keycloak.Service, error) {
+		return services[serverUrl], nil
+	}
+}
+
+func newFailoverTestBackend(t *testing.T, primary, secondary *keycloak.MockService) *backend {
+	t.Helper()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+	b.KeycloakServiceFactory = mockedFailoverFactory(map[string]keycloak.Service{
+		"https://dc1.example.com": primary,
+		"https://dc2.example.com": secondary,
+	})
+	return b
+}
+
+var failoverConfig = ConnectionConfig{
+	ServerUrl:    "https://dc1.example.com",
+	FailoverUrls: []string{"https://dc2.example.com"},
+	Realm:        "master",
+	ClientId:     "vault",
+	ClientSecret: "secret123",
+}
+
+func TestBackend_FailoverToSecondEndpoint(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		primary := &keycloak.MockService{}
+		primary.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(nil, &gocloak.APIError{Code: http.StatusServiceUnavailable}).Once()
+		secondary := &keycloak.MockService{}
+		secondary.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+			AccessToken: testutil.JWT(time.Hour),
+		}, nil).Once()
+		secondary.On("GetWellKnownOpenidConfiguration", mock.Anything, "master").Return(&keycloak.WellKnownOpenidConfiguration{
+			Issuer: "https://dc2.example.com/realms/master",
+		}, nil)
+		b := newFailoverTestBackend(t, primary, secondary)
+
+		_, token, err := b.getClientAndAccessToken(context.Background(), failoverConfig)
+		require.NoError(t, err)
+
+		// the failed endpoint is avoided and the token of the other one is reused
+		_, cachedToken, err := b.getClientAndAccessToken(context.Background(), failoverConfig)
+		require.NoError(t, err)
+		require.Same(t, token, cachedToken)
+
+		openidConfig, err := b.getGetWellKnownOpenidConfiguration(context.Background(), failoverConfig, "master")
+		require.NoError(t, err)
+		require.Equal(t, "https://dc2.example.com/realms/master", openidConfig.Issuer)
+
+		primary.AssertExpectations(t)
+		secondary.AssertExpectations(t)
+	})
+}
+
+func TestBackend_FailoverReturnsToRecoveredEndpoint(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		primary := &keycloak.MockService{}
+		primary.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(nil, &gocloak.APIError{Message: "connection refused"}).Once()
+		primary.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+			AccessToken: testutil.JWT(time.Hour),
+		}, nil).Once()
+		secondary := &keycloak.MockService{}
+		secondary.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+			AccessToken: testutil.JWT(time.Hour),
+		}, nil).Once()
+		b := newFailoverTestBackend(t, primary, secondary)
+
+		_, secondaryToken, err := b.getClientAndAccessToken(context.Background(), failoverConfig)
+		require.NoError(t, err)
+
+		// once the cooldown passed, the primary endpoint is preferred again
+		// and the token of the secondary one is not used there
+		time.Sleep(time.Minute)
+		_, primaryToken, err := b.getClientAndAccessToken(context.Background(), failoverConfig)
+		require.NoError(t, err)
+		require.NotSame(t, secondaryToken, primaryToken)
+
+		primary.AssertExpectations(t)
+		secondary.AssertExpectations(t)
+	})
+}
+
+func TestBackend_NoFailoverOnClientErrors(t *testing.T) {
+	primary := &keycloak.MockService{}
+	primary.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(nil, &gocloak.APIError{Code: http.StatusUnauthorized})
+	secondary := &keycloak.MockService{}
+	b := newFailoverTestBackend(t, primary, secondary)
+
+	_, _, err := b.getClientAndAccessToken(context.Background(), failoverConfig)
+	require.Error(t, err)
+	secondary.AssertNotCalled(t, "LoginClient", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBackend_ConfigConnectionWithFailoverUrls(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+	b.KeycloakServiceFactory = failingMockedGocloakFactory(t)
+
+	data := map[string]interface{}{
+		"server_url":                "https://dc1.example.com",
+		"failover_urls":             "https://dc2.example.com,not a url",
+		"realm":                     "master",
+		"client_id":                 "vault",
+		"client_secret":             "secret123",
+		"ignore_connectivity_check": true,
+	}
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data:      data,
+	})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	data["failover_urls"] = "https://dc2.example.com,https://dc3.example.com"
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data:      data,
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"https://dc2.example.com", "https://dc3.example.com"}, resp.Data["failover_urls"])
+}
+
+func TestBackend_FailoverOfAdminCallLogsInAgain(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		primaryToken := testutil.JWT(time.Hour)
+		secondaryToken := testutil.JWT(2 * time.Hour)
+		clientId := "myclient"
+		idOfClient := "internalId123"
+		secret := "mysecret"
+
+		primary := &keycloak.MockService{}
+		primary.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+			AccessToken: primaryToken,
+		}, nil).Once()
+		primary.On("GetClients", mock.Anything, primaryToken, "somerealm", keycloak.GetClientsParams{
+			ClientID: &clientId,
+		}).Return([]*keycloak.Client{{ID: &idOfClient}}, nil).Once()
+		primary.On("GetClientSecret", mock.Anything, primaryToken, "somerealm", idOfClient).Return((*keycloak.CredentialRepresentation)(nil), &gocloak.APIError{Code: http.StatusBadGateway}).Once()
+		// dc2 does not accept the token of dc1, so it is logged in to first
+		secondary := &keycloak.MockService{}
+		secondary.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+			AccessToken: secondaryToken,
+		}, nil).Once()
+		secondary.On("GetClientSecret", mock.Anything, secondaryToken, "somerealm", idOfClient).Return(&keycloak.CredentialRepresentation{
+			Value: &secret,
+		}, nil).Once()
+		b := newFailoverTestBackend(t, primary, secondary)
+
+		creds, err := b.readClientCredentialsOfRealm(context.Background(), "somerealm", clientId, failoverConfig)
+		require.NoError(t, err)
+		require.Equal(t, secret, creds.secret)
+
+		// the token of dc2 is cached for the next requests
+		_, token, err := b.getClientAndAccessToken(context.Background(), failoverConfig)
+		require.NoError(t, err)
+		require.Equal(t, secondaryToken, token.AccessToken)
+
+		primary.AssertExpectations(t)
+		secondary.AssertExpectations(t)
+	})
+}
+
+func TestBackend_NoFailoverOfChangesThatReachedKeycloak(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		clientId := "myclient"
+		idOfClient := "internalId123"
+
+		primary := &keycloak.MockService{}
+		primary.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+			AccessToken: testutil.JWT(time.Hour),
+		}, nil).Once()
+		primary.On("GetClients", mock.Anything, mock.Anything, "somerealm", keycloak.GetClientsParams{
+			ClientID: &clientId,
+		}).Return([]*keycloak.Client{{ID: &idOfClient}}, nil).Once()
+		primary.On("RegenerateClientSecret", mock.Anything, mock.Anything, "somerealm", idOfClient).Return((*keycloak.CredentialRepresentation)(nil), &gocloak.APIError{Code: http.StatusGatewayTimeout}).Once()
+		secondary := &keycloak.MockService{}
+		b := newFailoverTestBackend(t, primary, secondary)
+
+		// dc1 may have regenerated the secret, so it must not be regenerated again at dc2
+		_, err := b.regenerateClientSecretOfRealm(context.Background(), "somerealm", clientId, failoverConfig)
+		require.Error(t, err)
+
+		primary.AssertExpectations(t)
+		secondary.AssertNotCalled(t, "LoginClient", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		secondary.AssertNotCalled(t, "RegenerateClientSecret", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestBackend_ConfigConnectionChecksChangedFailoverUrls(t *testing.T) {
+	primary := &keycloak.MockService{}
+	primary.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: testutil.JWT(time.Hour),
+	}, nil)
+	secondary := &keycloak.MockService{}
+	secondary.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(nil, &gocloak.APIError{Code: http.StatusUnauthorized}).Once()
+	secondary.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: testutil.JWT(time.Hour),
+	}, nil).Once()
+	b := newFailoverTestBackend(t, primary, secondary)
+	storage := &logical.InmemStorage{}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"server_url":    "https://dc1.example.com",
+			"realm":         "master",
+			"client_id":     "vault",
+			"client_secret": "secret123",
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	secondary.AssertNotCalled(t, "LoginClient", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// a failover url that does not work is rejected, although the primary one does
+	patchReq := &logical.Request{
+		Operation: logical.PatchOperation,
+		Path:      "config/connection",
+		Storage:   storage,
+		Data:      map[string]interface{}{"failover_urls": "https://dc2.example.com"},
+	}
+	resp, err = b.HandleRequest(context.Background(), patchReq)
+	require.Error(t, err)
+	require.True(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), patchReq)
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	secondary.AssertExpectations(t)
+}
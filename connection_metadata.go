@@ -0,0 +1,87 @@
+package keycloak
+
+import (
+	"context"
+	"crypto/sha256"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/util/jwt"
+	"github.com/hashicorp/vault/sdk/helper/salt"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// getSalt returns the salt of the mount, which is created on first use.
+func (b *backend) getSalt(ctx context.Context, storage logical.Storage) (*salt.Salt, error) {
+	b.saltMutex.Lock()
+	defer b.saltMutex.Unlock()
+
+	if b.salt != nil {
+		return b.salt, nil
+	}
+
+	mountSalt, err := salt.NewSalt(ctx, storage, &salt.Config{
+		HashFunc: salt.SHA256Hash,
+		HMAC:     sha256.New,
+		HMACType: "hmac-sha256",
+		Location: salt.DefaultLocation,
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.salt = mountSalt
+	return mountSalt, nil
+}
+
+func (b *backend) invalidate(ctx context.Context, key string) {
+	if key == salt.DefaultLocation {
+		b.saltMutex.Lock()
+		defer b.saltMutex.Unlock()
+
+		b.salt = nil
+	}
+}
+
+// fingerprint identifies secret without revealing it, so that operators can
+// check which secret is configured.
+func (b *backend) fingerprint(ctx context.Context, storage logical.Storage, secret string) (string, error) {
+	mountSalt, err := b.getSalt(ctx, storage)
+	if err != nil {
+		return "", err
+	}
+	return mountSalt.GetIdentifiedHMAC(secret), nil
+}
+
+// addConnectionMetadata adds the non-sensitive state of config to the data of a response.
+func (b *backend) addConnectionMetadata(ctx context.Context, storage logical.Storage, config ConnectionConfig, data map[string]interface{}) error {
+	if config.ClientSecret != "" {
+		fingerprint, err := b.fingerprint(ctx, storage, config.ClientSecret)
+		if err != nil {
+			return err
+		}
+		data["client_secret_fingerprint"] = fingerprint
+	}
+	if config.Password != "" {
+		fingerprint, err := b.fingerprint(ctx, storage, config.Password)
+		if err != nil {
+			return err
+		}
+		data["password_fingerprint"] = fingerprint
+	}
+	if !config.LastUpdated.IsZero() {
+		data["last_updated"] = config.LastUpdated
+	}
+
+	if status, ok := b.loginStatusOf(config); ok && !status.lastSuccess.IsZero() {
+		data["last_successful_login"] = status.lastSuccess
+	}
+
+	b.jwtMutex.Lock()
+	cached, ok := b.jwt[config.key()]
+	b.jwtMutex.Unlock()
+	if ok {
+		if expiry, err := jwt.ExpirationTime(cached.token.AccessToken); err == nil {
+			data["token_expiry"] = expiry.UTC()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package keycloak
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+// transportFields describe how vault connects to keycloak.
+func transportFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"ca_cert": {
+			Type:        framework.TypeString,
+			Description: "PEM encoded CA certificates that are trusted in addition to the system's",
+		},
+		"tls_server_name": {
+			Type:        framework.TypeString,
+			Description: "Name that the certificate of keycloak is verified against instead of the host of server_url",
+		},
+		"tls_min_version": {
+			Type:          framework.TypeString,
+			Description:   "Minimum TLS version, defaults to tls12",
+			AllowedValues: []interface{}{"tls10", "tls11", "tls12", "tls13"},
+		},
+		"insecure_skip_verify": {
+			Type:        framework.TypeBool,
+			Description: "Do not verify the certificate of keycloak",
+		},
+		"client_cert": {
+			Type:        framework.TypeString,
+			Description: "PEM encoded client certificate for mutual TLS",
+		},
+		"client_key": {
+			Type:        framework.TypeString,
+			Description: "PEM encoded key of client_cert",
+		},
+		"tls_certificate_pin": {
+			Type:        framework.TypeString,
+			Description: "Hex encoded SHA-256 fingerprint that the certificate of keycloak must have",
+		},
+		"proxy_url": {
+			Type:        framework.TypeString,
+			Description: "URL of the proxy that requests to keycloak are sent through",
+		},
+		"no_proxy": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "Hosts, domains and CIDRs that are accessed without proxy_url",
+		},
+		"headers": {
+			Type:        framework.TypeKVPairs,
+			Description: "Headers that are sent along with every request to keycloak, e.g. for an API gateway",
+		},
+		"request_timeout": {
+			Type:        framework.TypeDurationSecond,
+			Description: "Timeout of each request to keycloak. Defaults to none, so that the timeout of the vault request applies",
+		},
+		"max_retries": {
+			Type:        framework.TypeInt,
+			Description: "How often reads and logins are retried if keycloak is unreachable or answers with 502, 503 or 504. Defaults to 0",
+		},
+		"retry_backoff": {
+			Type:        framework.TypeDurationSecond,
+			Description: "Delay before the first retry, which doubles with each further retry and is jittered. Defaults to 1s",
+		},
+	}
+}
+
+// TransportConfig describes how vault connects to keycloak.
+type TransportConfig struct {
+	CACert             string `json:"ca_cert"`
+	TLSServerName      string `json:"tls_server_name"`
+	TLSMinVersion      string `json:"tls_min_version"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	ClientCert         string `json:"client_cert"`
+	ClientKey          string `json:"client_key"`
+	TLSCertificatePin  string `json:"tls_certificate_pin"`
+
+	ProxyURL string            `json:"proxy_url"`
+	NoProxy  []string          `json:"no_proxy"`
+	Headers  map[string]string `json:"headers"`
+
+	RequestTimeout time.Duration `json:"request_timeout"`
+	MaxRetries     int           `json:"max_retries"`
+	RetryBackoff   time.Duration `json:"retry_backoff"`
+}
+
+// parseTransportFields merges the transport fields of data into c.
+func (c *TransportConfig) parseTransportFields(data *framework.FieldData) {
+	if caCert, ok := data.GetOk("ca_cert"); ok {
+		c.CACert = caCert.(string)
+	}
+	if tlsServerName, ok := data.GetOk("tls_server_name"); ok {
+		c.TLSServerName = tlsServerName.(string)
+	}
+	if tlsMinVersion, ok := data.GetOk("tls_min_version"); ok {
+		c.TLSMinVersion = tlsMinVersion.(string)
+	}
+	if insecureSkipVerify, ok := data.GetOk("insecure_skip_verify"); ok {
+		c.InsecureSkipVerify = insecureSkipVerify.(bool)
+	}
+	if clientCert, ok := data.GetOk("client_cert"); ok {
+		c.ClientCert = clientCert.(string)
+	}
+	if clientKey, ok := data.GetOk("client_key"); ok {
+		c.ClientKey = clientKey.(string)
+	}
+	if pin, ok := data.GetOk("tls_certificate_pin"); ok {
+		c.TLSCertificatePin = pin.(string)
+	}
+	if proxyURL, ok := data.GetOk("proxy_url"); ok {
+		c.ProxyURL = proxyURL.(string)
+	}
+	if noProxy, ok := data.GetOk("no_proxy"); ok {
+		c.NoProxy = noProxy.([]string)
+	}
+	if headers, ok := data.GetOk("headers"); ok {
+		c.Headers = headers.(map[string]string)
+	}
+	if requestTimeout, ok := data.GetOk("request_timeout"); ok {
+		c.RequestTimeout = time.Duration(requestTimeout.(int)) * time.Second
+	}
+	if maxRetries, ok := data.GetOk("max_retries"); ok {
+		c.MaxRetries = maxRetries.(int)
+	}
+	if retryBackoff, ok := data.GetOk("retry_backoff"); ok {
+		c.RetryBackoff = time.Duration(retryBackoff.(int)) * time.Second
+	}
+}
+
+// validateTransport reports settings that keycloak could not be connected with.
+func (c TransportConfig) validateTransport() error {
+	if c.RequestTimeout < 0 || c.MaxRetries < 0 || c.RetryBackoff < 0 {
+		return errors.New("request_timeout, max_retries and retry_backoff must not be negative")
+	}
+	_, err := c.serviceOptions().Transport()
+	return err
+}
+
+// sameTransport reports whether keycloak is connected to in the same way with
+// c and other, so that a connection that worked before still works.
+func (c TransportConfig) sameTransport(other TransportConfig) bool {
+	return reflect.DeepEqual(c.serviceOptions(), other.serviceOptions())
+}
+
+func (c TransportConfig) serviceOptions() keycloak.ServiceOptions {
+	return keycloak.ServiceOptions{
+		CACert:             c.CACert,
+		TLSServerName:      c.TLSServerName,
+		TLSMinVersion:      c.TLSMinVersion,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		ClientCert:         c.ClientCert,
+		ClientKey:          c.ClientKey,
+		CertificatePin:     c.TLSCertificatePin,
+		ProxyURL:           c.ProxyURL,
+		NoProxy:            c.NoProxy,
+		Headers:            c.Headers,
+		RequestTimeout:     c.RequestTimeout,
+	}
+}
+
+// addTransportData describes the transport settings that differ from the
+// defaults. Neither the client key nor the values of headers, which may hold
+// API keys, are returned.
+func (c TransportConfig) addTransportData(data map[string]interface{}) {
+	if c.CACert != "" {
+		data["ca_cert"] = c.CACert
+	}
+	if c.TLSServerName != "" {
+		data["tls_server_name"] = c.TLSServerName
+	}
+	if c.TLSMinVersion != "" {
+		data["tls_min_version"] = c.TLSMinVersion
+	}
+	if c.InsecureSkipVerify {
+		data["insecure_skip_verify"] = true
+	}
+	if c.ClientCert != "" {
+		data["client_cert"] = c.ClientCert
+	}
+	if c.TLSCertificatePin != "" {
+		data["tls_certificate_pin"] = c.TLSCertificatePin
+	}
+	if c.ProxyURL != "" {
+		data["proxy_url"] = c.ProxyURL
+	}
+	if len(c.NoProxy) > 0 {
+		data["no_proxy"] = c.NoProxy
+	}
+	if len(c.Headers) > 0 {
+		names := make([]string, 0, len(c.Headers))
+		for name := range c.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		data["header_names"] = names
+	}
+	if c.RequestTimeout > 0 {
+		data["request_timeout"] = int64(c.RequestTimeout.Seconds())
+	}
+	if c.MaxRetries > 0 {
+		data["max_retries"] = c.MaxRetries
+		data["retry_backoff"] = int64(c.retryBackoff().Seconds())
+	}
+}
+
+func (c TransportConfig) retryBackoff() time.Duration {
+	if c.RetryBackoff > 0 {
+		return c.RetryBackoff
+	}
+	return keycloak.DefaultRetryBackoff
+}
+
+// withRetries wraps service so that it retries as configured.
+func (c TransportConfig) withRetries(service keycloak.Service) keycloak.Service {
+	if c.MaxRetries == 0 {
+		return service
+	}
+	return keycloak.NewRetryService(service, c.MaxRetries, c.retryBackoff())
+}
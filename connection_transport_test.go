@@ -0,0 +1,429 @@
+package keycloak
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	testutil "github.com/Serviceware/vault-plugin-secrets-keycloak/util/test"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newWellKnownServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/realms/master/.well-known/openid-configuration", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"issuer":"https://auth.example.com/realms/master"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBackend_TransportTrustsConfiguredCA(t *testing.T) {
+	server := newWellKnownServer(t)
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	fingerprint := sha256.Sum256(server.Certificate().Raw)
+
+	b := &backend{KeycloakServiceFactory: keycloak.NewGocloakClient}
+	for name, tc := range map[string]struct {
+		transport TransportConfig
+		valid     bool
+	}{
+		"system CAs only": {
+			transport: TransportConfig{},
+		},
+		"ca_cert": {
+			transport: TransportConfig{CACert: caCert},
+			valid:     true,
+		},
+		"insecure_skip_verify": {
+			transport: TransportConfig{InsecureSkipVerify: true},
+			valid:     true,
+		},
+		"matching pin": {
+			transport: TransportConfig{CACert: caCert, TLSCertificatePin: hex.EncodeToString(fingerprint[:])},
+			valid:     true,
+		},
+		"other pin": {
+			transport: TransportConfig{CACert: caCert, TLSCertificatePin: hex.EncodeToString(make([]byte, sha256.Size))},
+		},
+		"tls13 only": {
+			transport: TransportConfig{CACert: caCert, TLSMinVersion: "tls13"},
+			valid:     true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := ConnectionConfig{ServerUrl: server.URL, TransportConfig: tc.transport}
+			openidConfig, err := b.getGetWellKnownOpenidConfiguration(context.Background(), config, "master")
+			if !tc.valid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "https://auth.example.com/realms/master", openidConfig.Issuer)
+		})
+	}
+}
+
+func TestBackend_ConfigConnectionRejectsInvalidTransport(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+	b.KeycloakServiceFactory = failingMockedGocloakFactory(t)
+
+	for name, data := range map[string]map[string]interface{}{
+		"ca_cert":             {"ca_cert": "not a certificate"},
+		"client_cert":         {"client_cert": "not a certificate", "client_key": "not a key"},
+		"tls_certificate_pin": {"tls_certificate_pin": "abc"},
+		"proxy_url":           {"proxy_url": "not a url"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data["server_url"] = "https://auth.example.com"
+			data["realm"] = "master"
+			data["client_id"] = "vault"
+			data["client_secret"] = "secret123"
+			data["ignore_connectivity_check"] = true
+
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      "config/connection",
+				Storage:   config.StorageView,
+				Data:      data,
+			})
+			require.NoError(t, err)
+			require.True(t, resp.IsError())
+		})
+	}
+}
+
+func TestBackend_TransportUsesProxyAndHeaders(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		require.Equal(t, "gateway-secret", r.Header.Get("X-Api-Key"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"issuer":"http://keycloak.internal/realms/master"}`))
+	}))
+	t.Cleanup(proxy.Close)
+
+	b := &backend{KeycloakServiceFactory: keycloak.NewGocloakClient}
+	config := ConnectionConfig{
+		ServerUrl: "http://keycloak.internal",
+		TransportConfig: TransportConfig{
+			ProxyURL: proxy.URL,
+			Headers:  map[string]string{"X-Api-Key": "gateway-secret"},
+		},
+	}
+
+	openidConfig, err := b.getGetWellKnownOpenidConfiguration(context.Background(), config, "master")
+	require.NoError(t, err)
+	require.Equal(t, "http://keycloak.internal/realms/master", openidConfig.Issuer)
+	require.Equal(t, []string{"http://keycloak.internal/realms/master/.well-known/openid-configuration"}, proxied)
+
+	// hosts in no_proxy are accessed directly, which fails for the made up host
+	config.NoProxy = []string{".internal"}
+	_, err = b.getGetWellKnownOpenidConfiguration(context.Background(), config, "master")
+	require.Error(t, err)
+	require.Len(t, proxied, 1)
+}
+
+func TestBackend_ReadConfigConnectionWithTransport(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+	b.KeycloakServiceFactory = failingMockedGocloakFactory(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url":                "https://auth.example.com",
+			"realm":                     "master",
+			"client_id":                 "vault",
+			"client_secret":             "secret123",
+			"proxy_url":                 "http://proxy.example.com:3128",
+			"no_proxy":                  "localhost,.internal",
+			"headers":                   map[string]interface{}{"X-Api-Key": "gateway-secret", "X-Tenant": "vault"},
+			"ignore_connectivity_check": true,
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "http://proxy.example.com:3128", resp.Data["proxy_url"])
+	require.Equal(t, []string{"localhost", ".internal"}, resp.Data["no_proxy"])
+	require.Equal(t, []string{"X-Api-Key", "X-Tenant"}, resp.Data["header_names"])
+	require.NotContains(t, resp.Data, "headers")
+}
+
+func TestBackend_RetriesIdempotentCalls(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		gocloakClientMock := &keycloak.MockService{}
+		gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(nil, &gocloak.APIError{Code: http.StatusBadGateway}).Once()
+		gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(nil, &gocloak.APIError{Message: "connection refused"}).Once()
+		gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+			AccessToken: "access123",
+		}, nil).Once()
+		gocloakClientMock.On("GetClientSecret", mock.Anything, "access123", "master", "myclient").Return((*keycloak.CredentialRepresentation)(nil), &gocloak.APIError{Code: http.StatusInternalServerError}).Once()
+		gocloakClientMock.On("RegenerateClientSecret", mock.Anything, "access123", "master", "myclient").Return(nil, &gocloak.APIError{Code: http.StatusServiceUnavailable}).Once()
+
+		b := &backend{KeycloakServiceFactory: keycloak.MockServiceFactoryFunc(gocloakClientMock)}
+		config := ConnectionConfig{
+			ServerUrl:       "http://auth.example.com",
+			Realm:           "master",
+			ClientId:        "vault",
+			ClientSecret:    "secret123",
+			TransportConfig: TransportConfig{MaxRetries: 2},
+		}
+		service, err := b.keycloakService(config)
+		require.NoError(t, err)
+
+		start := time.Now()
+		token, err := service.LoginClient(context.Background(), "vault", "secret123", "master")
+		require.NoError(t, err)
+		require.Equal(t, "access123", token.AccessToken)
+		// the delays of 1s and 2s are jittered by up to half
+		require.GreaterOrEqual(t, time.Since(start), 1500*time.Millisecond)
+		require.LessOrEqual(t, time.Since(start), 3*time.Second)
+
+		// neither server errors besides 502, 503 and 504 nor writes are retried
+		_, err = service.GetClientSecret(context.Background(), "access123", "master", "myclient")
+		require.Error(t, err)
+		_, err = service.RegenerateClientSecret(context.Background(), "access123", "master", "myclient")
+		require.Error(t, err)
+
+		gocloakClientMock.AssertExpectations(t)
+	})
+}
+
+func TestBackend_RequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	b := &backend{KeycloakServiceFactory: keycloak.NewGocloakClient}
+	config := ConnectionConfig{
+		ServerUrl:       server.URL,
+		TransportConfig: TransportConfig{RequestTimeout: time.Second},
+	}
+
+	start := time.Now()
+	_, err := b.getGetWellKnownOpenidConfiguration(context.Background(), config, "master")
+	require.Error(t, err)
+	require.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestBackend_ReadConfigConnectionWithRetries(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+	b.KeycloakServiceFactory = failingMockedGocloakFactory(t)
+
+	data := map[string]interface{}{
+		"server_url":                "https://auth.example.com",
+		"realm":                     "master",
+		"client_id":                 "vault",
+		"client_secret":             "secret123",
+		"request_timeout":           "10s",
+		"max_retries":               -1,
+		"ignore_connectivity_check": true,
+	}
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data:      data,
+	})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	data["max_retries"] = 3
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data:      data,
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 10, resp.Data["request_timeout"])
+	require.Equal(t, 3, resp.Data["max_retries"])
+	require.EqualValues(t, 1, resp.Data["retry_backoff"])
+}
+
+func TestBackend_ConfigConnectionChecksChangedTransport(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+
+	working := &keycloak.MockService{}
+	working.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: testutil.JWT(time.Hour),
+	}, nil)
+	failing := &keycloak.MockService{}
+	failing.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(nil, &gocloak.APIError{Message: "x509: certificate signed by unknown authority"})
+	// keycloak is only trusted with the system CAs
+	b.KeycloakServiceFactory = func(_ string, options keycloak.ServiceOptions) (keycloak.Service, error) {
+		if options.CACert != "" {
+			return failing, nil
+		}
+		return working, nil
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url":    "https://auth.example.com",
+			"realm":         "master",
+			"client_id":     "vault",
+			"client_secret": "secret123",
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	otherCA := newWellKnownServer(t).Certificate()
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.PatchOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"ca_cert": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherCA.Raw})),
+		},
+	})
+	require.Error(t, err)
+	require.True(t, resp.IsError())
+	failing.AssertCalled(t, "LoginClient", mock.Anything, "vault", "secret123", "master")
+}
+
+func TestBackend_ConfigConnectionChecksChangedProxy(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+
+	working := &keycloak.MockService{}
+	working.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: testutil.JWT(time.Hour),
+	}, nil)
+	failing := &keycloak.MockService{}
+	failing.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(nil, &gocloak.APIError{Message: "proxyconnect tcp: connection refused"})
+	// keycloak is reachable directly or with the gateway's API key only
+	b.KeycloakServiceFactory = func(_ string, options keycloak.ServiceOptions) (keycloak.Service, error) {
+		if options.ProxyURL != "" || (options.Headers != nil && options.Headers["X-Api-Key"] != "gateway-secret") {
+			return failing, nil
+		}
+		return working, nil
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url":    "https://auth.example.com",
+			"realm":         "master",
+			"client_id":     "vault",
+			"client_secret": "secret123",
+			"headers":       map[string]interface{}{"X-Api-Key": "gateway-secret"},
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	for name, data := range map[string]map[string]interface{}{
+		"proxy_url": {"proxy_url": "http://proxy.example.com:3128"},
+		"headers":   {"headers": map[string]interface{}{"X-Api-Key": "revoked"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.PatchOperation,
+				Path:      "config/connection",
+				Storage:   config.StorageView,
+				Data:      data,
+			})
+			require.Error(t, err)
+			require.True(t, resp.IsError())
+		})
+	}
+}
+
+func TestBackend_RetriesClientAssertionLoginsWithNewAssertion(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		var assertions []string
+		recordAssertion := func(args mock.Arguments) {
+			assertions = append(assertions, args.String(2))
+		}
+		gocloakClientMock := &keycloak.MockService{}
+		gocloakClientMock.On("LoginClientAssertion", mock.Anything, "vault", mock.Anything, "master").Run(recordAssertion).Return(nil, &gocloak.APIError{Code: http.StatusGatewayTimeout}).Once()
+		gocloakClientMock.On("LoginClientAssertion", mock.Anything, "vault", mock.Anything, "master").Run(recordAssertion).Return(&keycloak.JWT{
+			AccessToken: testutil.JWT(time.Hour),
+		}, nil).Once()
+
+		privateKey, err := generatePrivateKey()
+		require.NoError(t, err)
+		b := &backend{
+			KeycloakServiceFactory: keycloak.MockServiceFactoryFunc(gocloakClientMock),
+			jwt:                    map[connectionKey]cachedToken{},
+			loginMutexes:           map[connectionKey]*sync.Mutex{},
+			loginStatus:            map[connectionKey]loginStatus{},
+		}
+		_, _, err = b.getClientAndAccessToken(context.Background(), ConnectionConfig{
+			ServerUrl:       "http://auth.example.com",
+			Realm:           "master",
+			ClientId:        "vault",
+			AuthMethod:      authMethodClientJWT,
+			PrivateKey:      privateKey,
+			TransportConfig: TransportConfig{MaxRetries: 1},
+		})
+		require.NoError(t, err)
+
+		// the first assertion may have reached keycloak, which rejects it if replayed
+		require.Len(t, assertions, 2)
+		require.NotEqual(t, assertions[0], assertions[1])
+		gocloakClientMock.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,46 @@
+package keycloak
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Nerzal/gocloak/v13"
+	"github.com/go-resty/resty/v2"
+)
+
+// IsNotFound reports whether err was caused by keycloak answering with 404 Not Found.
+func IsNotFound(err error) bool {
+	var apiErr *gocloak.APIError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// IsUnavailable reports whether err was caused by keycloak not being
+// reachable or answering with a server error.
+func IsUnavailable(err error) bool {
+	var apiErr *gocloak.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == 0 || apiErr.Code >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// checkForError turns failed requests into [gocloak.APIError]s, like gocloak does for its own requests.
+func checkForError(resp *resty.Response, err error, errMessage string) error {
+	if err != nil {
+		return &gocloak.APIError{
+			Message: fmt.Sprintf("%s: %s", errMessage, err),
+			Type:    gocloak.ParseAPIErrType(err),
+		}
+	}
+	if resp == nil {
+		return &gocloak.APIError{Message: errMessage + ": empty response"}
+	}
+	if resp.IsError() {
+		return &gocloak.APIError{
+			Code:    resp.StatusCode(),
+			Message: fmt.Sprintf("%s: %s", errMessage, resp.Status()),
+		}
+	}
+	return nil
+}
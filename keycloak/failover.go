@@ -0,0 +1,291 @@
+package keycloak
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// failoverCooldown is how long an endpoint that failed is only used if all
+// others fail as well.
+const failoverCooldown = 30 * time.Second
+
+// Endpoints tracks the health of alternative keycloak endpoints. It is meant
+// to outlive the [FailoverService]s that use it, so that calls stick to the
+// endpoint that answered until it fails.
+type Endpoints struct {
+	urls []string
+
+	mutex    sync.Mutex
+	failedAt []time.Time
+}
+
+// NewEndpoints tracks the health of urls, which are preferred in their order.
+func NewEndpoints(urls []string) *Endpoints {
+	return &Endpoints{
+		urls:     urls,
+		failedAt: make([]time.Time, len(urls)),
+	}
+}
+
+// URLs returns the urls of the endpoints in their configured order.
+func (e *Endpoints) URLs() []string {
+	return e.urls
+}
+
+// Current returns the url of the endpoint that the next call will try first.
+func (e *Endpoints) Current() string {
+	return e.urls[e.order()[0]]
+}
+
+// order returns the indexes of the endpoints in the order they are tried:
+// first the healthy ones as configured, then the others in the order they failed.
+func (e *Endpoints) order() []int {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	now := time.Now()
+	healthy := make([]int, 0, len(e.urls))
+	var unhealthy []int
+	for i, failedAt := range e.failedAt {
+		if failedAt.IsZero() || now.Sub(failedAt) >= failoverCooldown {
+			healthy = append(healthy, i)
+			continue
+		}
+		unhealthy = append(unhealthy, i)
+	}
+	// the endpoint that failed first may have recovered first
+	sort.SliceStable(unhealthy, func(a, b int) bool {
+		return e.failedAt[unhealthy[a]].Before(e.failedAt[unhealthy[b]])
+	})
+	return append(healthy, unhealthy...)
+}
+
+func (e *Endpoints) markFailed(i int) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.failedAt[i] = time.Now()
+}
+
+func (e *Endpoints) markHealthy(i int) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.failedAt[i] = time.Time{}
+}
+
+// TokenSource returns the access token for calls to the endpoint with the
+// given url, logging in there with service if needed.
+type TokenSource func(ctx context.Context, url string, service Service) (string, error)
+
+// NewFailoverService creates a [Service] that calls the first healthy of
+// services and fails over to the next one if keycloak is unavailable, i.e.
+// on connection errors or 5xx responses. services correspond to the urls of
+// endpoints.
+//
+// As keycloak sites that fail over to each other may not accept each other's
+// access tokens, admin calls are made with the token that tokens returns for
+// the endpoint that is called rather than with the given one. Only logins,
+// token requests and reads fail over once they reached an endpoint. Calls
+// that change keycloak, like creating clients or regenerating secrets, may
+// have taken effect although the response got lost, so they only fail over
+// if they could not even log in.
+func NewFailoverService(endpoints *Endpoints, services []Service, tokens TokenSource) *FailoverService {
+	return &FailoverService{
+		endpoints: endpoints,
+		services:  services,
+		tokens:    tokens,
+	}
+}
+
+// FailoverService implements [Service] by failing over between several endpoints.
+type FailoverService struct {
+	endpoints *Endpoints
+	services  []Service
+	tokens    TokenSource
+}
+
+// EndpointOf returns the url of the endpoint that service calls next, if it
+// fails over between several. Otherwise, it returns an empty string.
+func EndpointOf(service Service) string {
+	if r, ok := service.(*RetryService); ok {
+		service = r.Service
+	}
+	if f, ok := service.(*FailoverService); ok {
+		return f.endpoints.Current()
+	}
+	return ""
+}
+
+func (f *FailoverService) do(ctx context.Context, call func(Service) error) error {
+	var err error
+	for _, i := range f.endpoints.order() {
+		err = call(f.services[i])
+		if err == nil || !IsUnavailable(err) || ctx.Err() != nil {
+			if err == nil {
+				f.endpoints.markHealthy(i)
+			}
+			return err
+		}
+		f.endpoints.markFailed(i)
+	}
+	return err
+}
+
+// doAdmin makes an admin call with the token of each endpoint that is tried.
+// Unless the call is idempotent, it is not repeated once it reached an endpoint.
+func (f *FailoverService) doAdmin(ctx context.Context, idempotent bool, call func(s Service, token string) error) error {
+	var err error
+	for _, i := range f.endpoints.order() {
+		var token string
+		sent := false
+		token, err = f.tokens(ctx, f.endpoints.urls[i], f.services[i])
+		if err == nil {
+			err = call(f.services[i], token)
+			sent = true
+		}
+		if err == nil || !IsUnavailable(err) || ctx.Err() != nil {
+			if err == nil {
+				f.endpoints.markHealthy(i)
+			}
+			return err
+		}
+		f.endpoints.markFailed(i)
+		if sent && !idempotent {
+			return err
+		}
+	}
+	return err
+}
+
+func failover[T any](ctx context.Context, f *FailoverService, call func(Service) (T, error)) (T, error) {
+	var result T
+	err := f.do(ctx, func(s Service) error {
+		var err error
+		result, err = call(s)
+		return err
+	})
+	return result, err
+}
+
+func failoverAdmin[T any](ctx context.Context, f *FailoverService, idempotent bool, call func(s Service, token string) (T, error)) (T, error) {
+	var result T
+	err := f.doAdmin(ctx, idempotent, func(s Service, token string) error {
+		var err error
+		result, err = call(s, token)
+		return err
+	})
+	return result, err
+}
+
+func (f *FailoverService) LoginClient(ctx context.Context, clientID string, clientSecret string, realm string) (*JWT, error) {
+	return failover(ctx, f, func(s Service) (*JWT, error) { return s.LoginClient(ctx, clientID, clientSecret, realm) })
+}
+
+func (f *FailoverService) LoginAdmin(ctx context.Context, username string, password string, realm string) (*JWT, error) {
+	return failover(ctx, f, func(s Service) (*JWT, error) { return s.LoginAdmin(ctx, username, password, realm) })
+}
+
+func (f *FailoverService) LoginClientAssertion(ctx context.Context, clientID string, clientAssertion string, realm string) (*JWT, error) {
+	return failover(ctx, f, func(s Service) (*JWT, error) { return s.LoginClientAssertion(ctx, clientID, clientAssertion, realm) })
+}
+
+func (f *FailoverService) GetToken(ctx context.Context, realm string, options TokenOptions) (*JWT, error) {
+	return failover(ctx, f, func(s Service) (*JWT, error) { return s.GetToken(ctx, realm, options) })
+}
+
+func (f *FailoverService) ExchangeToken(ctx context.Context, realm string, options TokenOptions) (*JWT, error) {
+	return failover(ctx, f, func(s Service) (*JWT, error) { return s.ExchangeToken(ctx, realm, options) })
+}
+
+func (f *FailoverService) GetClients(ctx context.Context, token string, realm string, params GetClientsParams) ([]*Client, error) {
+	return failoverAdmin(ctx, f, true, func(s Service, token string) ([]*Client, error) { return s.GetClients(ctx, token, realm, params) })
+}
+
+func (f *FailoverService) GetClientSecret(ctx context.Context, token string, realm string, clientID string) (*CredentialRepresentation, error) {
+	return failoverAdmin(ctx, f, true, func(s Service, token string) (*CredentialRepresentation, error) {
+		return s.GetClientSecret(ctx, token, realm, clientID)
+	})
+}
+
+func (f *FailoverService) RegenerateClientSecret(ctx context.Context, token string, realm string, clientID string) (*CredentialRepresentation, error) {
+	return failoverAdmin(ctx, f, false, func(s Service, token string) (*CredentialRepresentation, error) {
+		return s.RegenerateClientSecret(ctx, token, realm, clientID)
+	})
+}
+
+func (f *FailoverService) GetClientRotatedSecret(ctx context.Context, token string, realm string, clientID string) (*CredentialRepresentation, error) {
+	return failoverAdmin(ctx, f, true, func(s Service, token string) (*CredentialRepresentation, error) {
+		return s.GetClientRotatedSecret(ctx, token, realm, clientID)
+	})
+}
+
+func (f *FailoverService) InvalidateClientRotatedSecret(ctx context.Context, token string, realm string, clientID string) error {
+	return f.doAdmin(ctx, false, func(s Service, token string) error {
+		return s.InvalidateClientRotatedSecret(ctx, token, realm, clientID)
+	})
+}
+
+func (f *FailoverService) CreateClient(ctx context.Context, token string, realm string, client Client) (string, error) {
+	return failoverAdmin(ctx, f, false, func(s Service, token string) (string, error) { return s.CreateClient(ctx, token, realm, client) })
+}
+
+func (f *FailoverService) DeleteClient(ctx context.Context, token string, realm string, clientID string) error {
+	return f.doAdmin(ctx, false, func(s Service, token string) error { return s.DeleteClient(ctx, token, realm, clientID) })
+}
+
+func (f *FailoverService) GetClientServiceAccount(ctx context.Context, token string, realm string, clientID string) (*User, error) {
+	return failoverAdmin(ctx, f, true, func(s Service, token string) (*User, error) {
+		return s.GetClientServiceAccount(ctx, token, realm, clientID)
+	})
+}
+
+func (f *FailoverService) GetRealmRole(ctx context.Context, token string, realm string, roleName string) (*Role, error) {
+	return failoverAdmin(ctx, f, true, func(s Service, token string) (*Role, error) { return s.GetRealmRole(ctx, token, realm, roleName) })
+}
+
+func (f *FailoverService) AddRealmRoleToUser(ctx context.Context, token string, realm string, userID string, roles []Role) error {
+	return f.doAdmin(ctx, false, func(s Service, token string) error { return s.AddRealmRoleToUser(ctx, token, realm, userID, roles) })
+}
+
+func (f *FailoverService) GetClientRole(ctx context.Context, token string, realm string, clientID string, roleName string) (*Role, error) {
+	return failoverAdmin(ctx, f, true, func(s Service, token string) (*Role, error) {
+		return s.GetClientRole(ctx, token, realm, clientID, roleName)
+	})
+}
+
+func (f *FailoverService) AddClientRolesToUser(ctx context.Context, token string, realm string, clientID string, userID string, roles []Role) error {
+	return f.doAdmin(ctx, false, func(s Service, token string) error {
+		return s.AddClientRolesToUser(ctx, token, realm, clientID, userID, roles)
+	})
+}
+
+func (f *FailoverService) CreateUser(ctx context.Context, token string, realm string, user User) (string, error) {
+	return failoverAdmin(ctx, f, false, func(s Service, token string) (string, error) { return s.CreateUser(ctx, token, realm, user) })
+}
+
+func (f *FailoverService) DeleteUser(ctx context.Context, token string, realm string, userID string) error {
+	return f.doAdmin(ctx, false, func(s Service, token string) error { return s.DeleteUser(ctx, token, realm, userID) })
+}
+
+func (f *FailoverService) SetPassword(ctx context.Context, token string, userID string, realm string, password string, temporary bool) error {
+	return f.doAdmin(ctx, false, func(s Service, token string) error {
+		return s.SetPassword(ctx, token, userID, realm, password, temporary)
+	})
+}
+
+func (f *FailoverService) GetGroupByPath(ctx context.Context, token string, realm string, groupPath string) (*Group, error) {
+	return failoverAdmin(ctx, f, true, func(s Service, token string) (*Group, error) { return s.GetGroupByPath(ctx, token, realm, groupPath) })
+}
+
+func (f *FailoverService) AddUserToGroup(ctx context.Context, token string, realm string, userID string, groupID string) error {
+	return f.doAdmin(ctx, false, func(s Service, token string) error { return s.AddUserToGroup(ctx, token, realm, userID, groupID) })
+}
+
+func (f *FailoverService) GetWellKnownOpenidConfiguration(ctx context.Context, realm string) (*WellKnownOpenidConfiguration, error) {
+	return failover(ctx, f, func(s Service) (*WellKnownOpenidConfiguration, error) {
+		return s.GetWellKnownOpenidConfiguration(ctx, realm)
+	})
+}
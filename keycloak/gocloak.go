@@ -2,27 +2,39 @@ package keycloak
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
+	"net/url"
 
 	"github.com/Nerzal/gocloak/v13"
 )
 
 // NewGocloakClient is compatible with [ServiceFactoryFunc] and creates a [Service] instance
 // by wrapping [gocloak.NewClient].
-func NewGocloakClient(serverUrl string) Service {
+func NewGocloakClient(serverUrl string, options ServiceOptions) (Service, error) {
+	transport, err := options.Transport()
+	if err != nil {
+		return nil, err
+	}
+
 	gocloakClient := gocloak.NewClient(serverUrl)
+	gocloakClient.RestyClient().SetTransport(transport).SetHeaders(options.Headers).SetTimeout(options.RequestTimeout)
+
+	publicUrl := options.PublicURL
+	if publicUrl == "" {
+		publicUrl = serverUrl
+	}
 
 	return &GocloakService{
 		serverUrl:     serverUrl,
+		publicUrl:     publicUrl,
 		gocloakClient: gocloakClient,
-	}
+	}, nil
 }
 
 // GocloakService implements [Service] through the [gocloak] package.
 type GocloakService struct {
 	serverUrl     string
+	publicUrl     string
 	gocloakClient *gocloak.GoCloak
 }
 
@@ -31,6 +43,39 @@ func (g *GocloakService) LoginClient(ctx context.Context, clientID string, clien
 	return (*JWT)(jwt), err
 }
 
+func (g *GocloakService) LoginAdmin(ctx context.Context, username string, password string, realm string) (*JWT, error) {
+	jwt, err := g.gocloakClient.LoginAdmin(ctx, username, password, realm)
+	return (*JWT)(jwt), err
+}
+
+// ClientAssertionTypeJWTBearer is the type of client assertions that are signed JWTs.
+const ClientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+func (g *GocloakService) LoginClientAssertion(ctx context.Context, clientID string, clientAssertion string, realm string) (*JWT, error) {
+	grantType := "client_credentials"
+	assertionType := ClientAssertionTypeJWTBearer
+	return g.GetToken(ctx, realm, TokenOptions{
+		ClientID:            &clientID,
+		GrantType:           &grantType,
+		ClientAssertionType: &assertionType,
+		ClientAssertion:     &clientAssertion,
+	})
+}
+
+func (g *GocloakService) GetToken(ctx context.Context, realm string, options TokenOptions) (*JWT, error) {
+	jwt, err := g.gocloakClient.GetToken(ctx, realm, gocloak.TokenOptions(options))
+	return (*JWT)(jwt), err
+}
+
+// GrantTypeTokenExchange is the grant type of the OAuth 2.0 token exchange.
+const GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+func (g *GocloakService) ExchangeToken(ctx context.Context, realm string, options TokenOptions) (*JWT, error) {
+	grantType := GrantTypeTokenExchange
+	options.GrantType = &grantType
+	return g.GetToken(ctx, realm, options)
+}
+
 func (g *GocloakService) GetClients(ctx context.Context, token string, realm string, params GetClientsParams) ([]*Client, error) {
 	goCloakClients, err := g.gocloakClient.GetClients(ctx, token, realm, gocloak.GetClientsParams(params))
 	if err != nil {
@@ -50,14 +95,100 @@ func (g *GocloakService) GetClientSecret(ctx context.Context, token string, real
 	return (*CredentialRepresentation)(credentials), err
 }
 
-func (g *GocloakService) GetWellKnownOpenidConfiguration(ctx context.Context, realm string) (*WellKnownOpenidConfiguration, error) {
-	res, err := http.Get(fmt.Sprintf("%s/realms/%s/.well-known/openid-configuration", g.serverUrl, realm))
-	if err != nil {
+func (g *GocloakService) RegenerateClientSecret(ctx context.Context, token string, realm string, clientID string) (*CredentialRepresentation, error) {
+	credentials, err := g.gocloakClient.RegenerateClientSecret(ctx, token, realm, clientID)
+	return (*CredentialRepresentation)(credentials), err
+}
+
+// gocloak lacks the rotated secret endpoints, so they are requested directly.
+func (g *GocloakService) GetClientRotatedSecret(ctx context.Context, token string, realm string, clientID string) (*CredentialRepresentation, error) {
+	var credentials CredentialRepresentation
+	resp, err := g.gocloakClient.GetRequestWithBearerAuth(ctx, token).
+		SetResult(&credentials).
+		Get(g.rotatedSecretURL(realm, clientID))
+	if err := checkForError(resp, err, "could not get rotated client secret"); err != nil {
 		return nil, err
 	}
+	return &credentials, nil
+}
+
+func (g *GocloakService) InvalidateClientRotatedSecret(ctx context.Context, token string, realm string, clientID string) error {
+	resp, err := g.gocloakClient.GetRequestWithBearerAuth(ctx, token).
+		Delete(g.rotatedSecretURL(realm, clientID))
+	return checkForError(resp, err, "could not invalidate rotated client secret")
+}
+
+func (g *GocloakService) rotatedSecretURL(realm string, clientID string) string {
+	return fmt.Sprintf("%s/admin/realms/%s/clients/%s/client-secret/rotated", g.serverUrl, url.PathEscape(realm), url.PathEscape(clientID))
+}
 
+func (g *GocloakService) CreateClient(ctx context.Context, token string, realm string, client Client) (string, error) {
+	return g.gocloakClient.CreateClient(ctx, token, realm, gocloak.Client(client))
+}
+
+func (g *GocloakService) DeleteClient(ctx context.Context, token string, realm string, clientID string) error {
+	return g.gocloakClient.DeleteClient(ctx, token, realm, clientID)
+}
+
+func (g *GocloakService) GetClientServiceAccount(ctx context.Context, token string, realm string, clientID string) (*User, error) {
+	user, err := g.gocloakClient.GetClientServiceAccount(ctx, token, realm, clientID)
+	return (*User)(user), err
+}
+
+func (g *GocloakService) GetRealmRole(ctx context.Context, token string, realm string, roleName string) (*Role, error) {
+	role, err := g.gocloakClient.GetRealmRole(ctx, token, realm, roleName)
+	return (*Role)(role), err
+}
+
+func (g *GocloakService) AddRealmRoleToUser(ctx context.Context, token string, realm string, userID string, roles []Role) error {
+	return g.gocloakClient.AddRealmRoleToUser(ctx, token, realm, userID, toGocloakRoles(roles))
+}
+
+func (g *GocloakService) GetClientRole(ctx context.Context, token string, realm string, clientID string, roleName string) (*Role, error) {
+	role, err := g.gocloakClient.GetClientRole(ctx, token, realm, clientID, roleName)
+	return (*Role)(role), err
+}
+
+func (g *GocloakService) AddClientRolesToUser(ctx context.Context, token string, realm string, clientID string, userID string, roles []Role) error {
+	return g.gocloakClient.AddClientRolesToUser(ctx, token, realm, clientID, userID, toGocloakRoles(roles))
+}
+
+func toGocloakRoles(roles []Role) []gocloak.Role {
+	gocloakRoles := make([]gocloak.Role, len(roles))
+	for i, role := range roles {
+		gocloakRoles[i] = gocloak.Role(role)
+	}
+	return gocloakRoles
+}
+
+func (g *GocloakService) CreateUser(ctx context.Context, token string, realm string, user User) (string, error) {
+	return g.gocloakClient.CreateUser(ctx, token, realm, gocloak.User(user))
+}
+
+func (g *GocloakService) DeleteUser(ctx context.Context, token string, realm string, userID string) error {
+	return g.gocloakClient.DeleteUser(ctx, token, realm, userID)
+}
+
+func (g *GocloakService) SetPassword(ctx context.Context, token string, userID string, realm string, password string, temporary bool) error {
+	return g.gocloakClient.SetPassword(ctx, token, userID, realm, password, temporary)
+}
+
+func (g *GocloakService) GetGroupByPath(ctx context.Context, token string, realm string, groupPath string) (*Group, error) {
+	group, err := g.gocloakClient.GetGroupByPath(ctx, token, realm, groupPath)
+	return (*Group)(group), err
+}
+
+func (g *GocloakService) AddUserToGroup(ctx context.Context, token string, realm string, userID string, groupID string) error {
+	return g.gocloakClient.AddUserToGroup(ctx, token, realm, userID, groupID)
+}
+
+func (g *GocloakService) GetWellKnownOpenidConfiguration(ctx context.Context, realm string) (*WellKnownOpenidConfiguration, error) {
 	config := &WellKnownOpenidConfiguration{}
-	if err = json.NewDecoder(res.Body).Decode(config); err != nil {
+	resp, err := g.gocloakClient.RestyClient().R().
+		SetContext(ctx).
+		SetResult(config).
+		Get(fmt.Sprintf("%s/realms/%s/.well-known/openid-configuration", g.publicUrl, url.PathEscape(realm)))
+	if err := checkForError(resp, err, "could not get openid configuration"); err != nil {
 		return nil, err
 	}
 
@@ -8,8 +8,24 @@ import (
 	"github.com/Nerzal/gocloak/v13"
 )
 
+// WellKnownOpenidConfiguration is the OpenID Connect discovery document of a realm.
 type WellKnownOpenidConfiguration struct {
-	Issuer string `json:"issuer"`
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	EndSessionEndpoint                string   `json:"end_session_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	JwksURI                           string   `json:"jwks_uri"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
 }
 
 // Types, that the [Service] returns.
@@ -19,16 +35,43 @@ type (
 	Client                   gocloak.Client
 	GetClientsParams         gocloak.GetClientsParams
 	CredentialRepresentation gocloak.CredentialRepresentation
+	User                     gocloak.User
+	Role                     gocloak.Role
+	Group                    gocloak.Group
+	TokenOptions             gocloak.TokenOptions
 )
 
 // Service describes the relevant subset of keycloak functionality for providing secrets to vault.
 type Service interface {
 	// Defining the methods in the style of [gocloak.GoCloak].
 	LoginClient(ctx context.Context, clientID string, clientSecret string, realm string) (*JWT, error)
+	// LoginAdmin logs a user in with the password grant of the admin-cli client.
+	LoginAdmin(ctx context.Context, username string, password string, realm string) (*JWT, error)
+	// LoginClientAssertion logs the client in with a signed JWT (RFC 7523) instead of its secret.
+	LoginClientAssertion(ctx context.Context, clientID string, clientAssertion string, realm string) (*JWT, error)
+	GetToken(ctx context.Context, realm string, options TokenOptions) (*JWT, error)
+	// ExchangeToken performs an OAuth 2.0 token exchange (RFC 8693) as the client of options.
+	ExchangeToken(ctx context.Context, realm string, options TokenOptions) (*JWT, error)
 	GetClients(ctx context.Context, token string, realm string, params GetClientsParams) ([]*Client, error)
 	GetClientSecret(ctx context.Context, token string, realm string, clientID string) (*CredentialRepresentation, error)
+	RegenerateClientSecret(ctx context.Context, token string, realm string, clientID string) (*CredentialRepresentation, error)
+	// GetClientRotatedSecret returns the previous secret that keycloak's client secret rotation policy keeps valid.
+	GetClientRotatedSecret(ctx context.Context, token string, realm string, clientID string) (*CredentialRepresentation, error)
+	InvalidateClientRotatedSecret(ctx context.Context, token string, realm string, clientID string) error
+	CreateClient(ctx context.Context, token string, realm string, client Client) (string, error)
+	DeleteClient(ctx context.Context, token string, realm string, clientID string) error
+	GetClientServiceAccount(ctx context.Context, token string, realm string, clientID string) (*User, error)
+	GetRealmRole(ctx context.Context, token string, realm string, roleName string) (*Role, error)
+	AddRealmRoleToUser(ctx context.Context, token string, realm string, userID string, roles []Role) error
+	GetClientRole(ctx context.Context, token string, realm string, clientID string, roleName string) (*Role, error)
+	AddClientRolesToUser(ctx context.Context, token string, realm string, clientID string, userID string, roles []Role) error
+	CreateUser(ctx context.Context, token string, realm string, user User) (string, error)
+	DeleteUser(ctx context.Context, token string, realm string, userID string) error
+	SetPassword(ctx context.Context, token string, userID string, realm string, password string, temporary bool) error
+	GetGroupByPath(ctx context.Context, token string, realm string, groupPath string) (*Group, error)
+	AddUserToGroup(ctx context.Context, token string, realm string, userID string, groupID string) error
 	GetWellKnownOpenidConfiguration(ctx context.Context, realm string) (*WellKnownOpenidConfiguration, error)
 }
 
 // ServiceFactoryFunc is a kind of function that creates new [Service] instances.
-type ServiceFactoryFunc func(serverUrl string) Service
+type ServiceFactoryFunc func(serverUrl string, options ServiceOptions) (Service, error)
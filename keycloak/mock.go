@@ -9,7 +9,7 @@ import (
 // MockServiceFactoryFunc creates a new [ServiceFactoryFunc] that always
 // returns service.
 func MockServiceFactoryFunc(service Service) ServiceFactoryFunc {
-	return func(_ string) Service { return service }
+	return func(_ string, _ ServiceOptions) (Service, error) { return service, nil }
 }
 
 // MockService implements [Service] by delegating function calls to
@@ -26,6 +26,32 @@ func (m *MockService) LoginClient(ctx context.Context, clientID string, clientSe
 	}
 	return t, args.Error(1)
 }
+func (m *MockService) LoginAdmin(ctx context.Context, username string, password string, realm string) (*JWT, error) {
+	args := m.Called(ctx, username, password, realm)
+	var t *JWT = nil
+	if args.Get(0) != nil {
+		t = args.Get(0).(*JWT)
+	}
+	return t, args.Error(1)
+}
+func (m *MockService) LoginClientAssertion(ctx context.Context, clientID string, clientAssertion string, realm string) (*JWT, error) {
+	args := m.Called(ctx, clientID, clientAssertion, realm)
+	var t *JWT = nil
+	if args.Get(0) != nil {
+		t = args.Get(0).(*JWT)
+	}
+	return t, args.Error(1)
+}
+func (m *MockService) GetToken(ctx context.Context, realm string, options TokenOptions) (*JWT, error) {
+	args := m.Called(ctx, realm, options)
+	t, _ := args.Get(0).(*JWT)
+	return t, args.Error(1)
+}
+func (m *MockService) ExchangeToken(ctx context.Context, realm string, options TokenOptions) (*JWT, error) {
+	args := m.Called(ctx, realm, options)
+	t, _ := args.Get(0).(*JWT)
+	return t, args.Error(1)
+}
 func (m *MockService) GetClients(ctx context.Context, token string, realm string, params GetClientsParams) ([]*Client, error) {
 	args := m.Called(ctx, token, realm, params)
 	return args.Get(0).([]*Client), args.Error(1)
@@ -34,6 +60,72 @@ func (m *MockService) GetClientSecret(ctx context.Context, token string, realm s
 	args := m.Called(ctx, token, realm, clientID)
 	return args.Get(0).(*CredentialRepresentation), args.Error(1)
 }
+func (m *MockService) RegenerateClientSecret(ctx context.Context, token string, realm string, clientID string) (*CredentialRepresentation, error) {
+	args := m.Called(ctx, token, realm, clientID)
+	creds, _ := args.Get(0).(*CredentialRepresentation)
+	return creds, args.Error(1)
+}
+func (m *MockService) GetClientRotatedSecret(ctx context.Context, token string, realm string, clientID string) (*CredentialRepresentation, error) {
+	args := m.Called(ctx, token, realm, clientID)
+	creds, _ := args.Get(0).(*CredentialRepresentation)
+	return creds, args.Error(1)
+}
+func (m *MockService) InvalidateClientRotatedSecret(ctx context.Context, token string, realm string, clientID string) error {
+	args := m.Called(ctx, token, realm, clientID)
+	return args.Error(0)
+}
+func (m *MockService) CreateClient(ctx context.Context, token string, realm string, client Client) (string, error) {
+	args := m.Called(ctx, token, realm, client)
+	return args.String(0), args.Error(1)
+}
+func (m *MockService) DeleteClient(ctx context.Context, token string, realm string, clientID string) error {
+	args := m.Called(ctx, token, realm, clientID)
+	return args.Error(0)
+}
+func (m *MockService) GetClientServiceAccount(ctx context.Context, token string, realm string, clientID string) (*User, error) {
+	args := m.Called(ctx, token, realm, clientID)
+	user, _ := args.Get(0).(*User)
+	return user, args.Error(1)
+}
+func (m *MockService) GetRealmRole(ctx context.Context, token string, realm string, roleName string) (*Role, error) {
+	args := m.Called(ctx, token, realm, roleName)
+	role, _ := args.Get(0).(*Role)
+	return role, args.Error(1)
+}
+func (m *MockService) AddRealmRoleToUser(ctx context.Context, token string, realm string, userID string, roles []Role) error {
+	args := m.Called(ctx, token, realm, userID, roles)
+	return args.Error(0)
+}
+func (m *MockService) GetClientRole(ctx context.Context, token string, realm string, clientID string, roleName string) (*Role, error) {
+	args := m.Called(ctx, token, realm, clientID, roleName)
+	role, _ := args.Get(0).(*Role)
+	return role, args.Error(1)
+}
+func (m *MockService) AddClientRolesToUser(ctx context.Context, token string, realm string, clientID string, userID string, roles []Role) error {
+	args := m.Called(ctx, token, realm, clientID, userID, roles)
+	return args.Error(0)
+}
+func (m *MockService) CreateUser(ctx context.Context, token string, realm string, user User) (string, error) {
+	args := m.Called(ctx, token, realm, user)
+	return args.String(0), args.Error(1)
+}
+func (m *MockService) DeleteUser(ctx context.Context, token string, realm string, userID string) error {
+	args := m.Called(ctx, token, realm, userID)
+	return args.Error(0)
+}
+func (m *MockService) SetPassword(ctx context.Context, token string, userID string, realm string, password string, temporary bool) error {
+	args := m.Called(ctx, token, userID, realm, password, temporary)
+	return args.Error(0)
+}
+func (m *MockService) GetGroupByPath(ctx context.Context, token string, realm string, groupPath string) (*Group, error) {
+	args := m.Called(ctx, token, realm, groupPath)
+	group, _ := args.Get(0).(*Group)
+	return group, args.Error(1)
+}
+func (m *MockService) AddUserToGroup(ctx context.Context, token string, realm string, userID string, groupID string) error {
+	args := m.Called(ctx, token, realm, userID, groupID)
+	return args.Error(0)
+}
 func (m *MockService) GetWellKnownOpenidConfiguration(ctx context.Context, realm string) (*WellKnownOpenidConfiguration, error) {
 	args := m.Called(ctx, realm)
 	wkoc, _ := args.Get(0).(*WellKnownOpenidConfiguration)
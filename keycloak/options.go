@@ -0,0 +1,138 @@
+package keycloak
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ServiceOptions configure how a [Service] connects to keycloak.
+type ServiceOptions struct {
+	// PublicURL is the URL under which apps reach keycloak. The OpenID
+	// configuration is looked up there, so that it names the issuer that tokens
+	// carry. Defaults to the server URL, which all other calls use.
+	PublicURL string
+
+	// CACert is a PEM encoded bundle of the CAs that are trusted besides the system's.
+	CACert string
+	// TLSServerName overrides the name that the server certificate is verified against.
+	TLSServerName string
+	// TLSMinVersion is the minimum TLS version, e.g. tls12. Defaults to tls12.
+	TLSMinVersion string
+	// InsecureSkipVerify disables the verification of the server certificate.
+	InsecureSkipVerify bool
+	// ClientCert and ClientKey are the PEM encoded certificate and key for mutual TLS.
+	ClientCert string
+	ClientKey  string
+	// CertificatePin is the hex encoded SHA-256 fingerprint that the server's
+	// leaf certificate must have.
+	CertificatePin string
+
+	// ProxyURL is the proxy of all requests, unless the host matches NoProxy.
+	ProxyURL string
+	// NoProxy lists hosts, domains and CIDRs that are accessed directly.
+	NoProxy []string
+	// Headers are sent along with every request, e.g. for an API gateway.
+	Headers map[string]string
+
+	// RequestTimeout limits each request to keycloak, unless it is 0.
+	RequestTimeout time.Duration
+}
+
+var tlsVersions = map[string]uint16{
+	"tls10": tls.VersionTLS10,
+	"tls11": tls.VersionTLS11,
+	"tls12": tls.VersionTLS12,
+	"tls13": tls.VersionTLS13,
+}
+
+// TLSConfig creates the TLS configuration described by the options.
+func (o ServiceOptions) TLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         o.TLSServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if o.TLSMinVersion != "" {
+		version, ok := tlsVersions[o.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid tls_min_version %q", o.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if o.CACert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM([]byte(o.CACert)) {
+			return nil, errors.New("ca_cert contains no PEM encoded certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if o.ClientCert != "" || o.ClientKey != "" {
+		certificate, err := tls.X509KeyPair([]byte(o.ClientCert), []byte(o.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid client_cert or client_key: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if o.CertificatePin != "" {
+		pin, err := hex.DecodeString(strings.ReplaceAll(o.CertificatePin, ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			return nil, errors.New("the certificate pin must be a hex encoded SHA-256 fingerprint")
+		}
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("keycloak presented no certificate")
+			}
+			fingerprint := sha256.Sum256(state.PeerCertificates[0].Raw)
+			if subtle.ConstantTimeCompare(fingerprint[:], pin) != 1 {
+				return errors.New("the certificate of keycloak does not match the pin")
+			}
+			return nil
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// Transport creates the HTTP transport for all calls to keycloak.
+func (o ServiceOptions) Transport() (*http.Transport, error) {
+	tlsConfig, err := o.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if o.ProxyURL != "" {
+		proxyURL, err := url.Parse(o.ProxyURL)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy_url %q", o.ProxyURL)
+		}
+		proxyFunc := (&httpproxy.Config{
+			HTTPProxy:  o.ProxyURL,
+			HTTPSProxy: o.ProxyURL,
+			NoProxy:    strings.Join(o.NoProxy, ","),
+		}).ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+	}
+	return transport, nil
+}
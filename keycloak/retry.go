@@ -0,0 +1,164 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/Nerzal/gocloak/v13"
+)
+
+const (
+	// DefaultRetryBackoff is the delay before the first retry if none is configured.
+	DefaultRetryBackoff = time.Second
+	// maxRetryBackoff caps the delay between retries, which doubles with each attempt.
+	maxRetryBackoff = 30 * time.Second
+)
+
+// NewRetryService creates a [Service] that retries idempotent calls of service
+// up to maxRetries times if keycloak is temporarily unavailable, i.e. on
+// network errors or 502, 503 and 504 responses. The delay before each retry
+// doubles, starting with backoff, and is jittered so that clients do not
+// retry in lockstep.
+func NewRetryService(service Service, maxRetries int, backoff time.Duration) *RetryService {
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	return &RetryService{
+		Service:    service,
+		maxRetries: maxRetries,
+		backoff:    backoff,
+	}
+}
+
+// RetryService implements [Service] by retrying the idempotent calls of the
+// embedded Service. Calls that change keycloak, like creating clients or
+// regenerating secrets, are passed through as they are, as they may have
+// taken effect although the response got lost.
+type RetryService struct {
+	Service
+	maxRetries int
+	backoff    time.Duration
+}
+
+// isTransient reports whether err was caused by keycloak being temporarily
+// unreachable, so that the same call may succeed later.
+func isTransient(err error) bool {
+	var apiErr *gocloak.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case 0, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// delay returns the jittered delay before the given retry, starting at 0.
+func (r *RetryService) delay(retry int) time.Duration {
+	delay := maxRetryBackoff
+	if retry < 16 && r.backoff<<retry < maxRetryBackoff {
+		delay = r.backoff << retry
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func (r *RetryService) do(ctx context.Context, call func() error) error {
+	err := call()
+	for retry := 0; retry < r.maxRetries && isTransient(err) && ctx.Err() == nil; retry++ {
+		timer := time.NewTimer(r.delay(retry))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = call()
+	}
+	return err
+}
+
+func retry[T any](ctx context.Context, r *RetryService, call func() (T, error)) (T, error) {
+	var result T
+	err := r.do(ctx, func() error {
+		var err error
+		result, err = call()
+		return err
+	})
+	return result, err
+}
+
+// Repeat makes call with service like service makes its idempotent calls,
+// i.e. it is retried or failed over, but call prepares each attempt anew. This
+// allows to sign a new client assertion for each attempt, as keycloak rejects
+// assertions that it has seen before even if their response got lost.
+func Repeat[T any](ctx context.Context, service Service, call func(Service) (T, error)) (T, error) {
+	switch s := service.(type) {
+	case *RetryService:
+		return retry(ctx, s, func() (T, error) { return Repeat(ctx, s.Service, call) })
+	case *FailoverService:
+		return failover(ctx, s, func(service Service) (T, error) { return Repeat(ctx, service, call) })
+	}
+	return call(service)
+}
+
+// Logins and token requests only issue tokens, so they are retried like reads.
+// Logins with client assertions are not, as the assertion would be replayed;
+// they are retried with [Repeat] instead.
+
+func (r *RetryService) LoginClient(ctx context.Context, clientID string, clientSecret string, realm string) (*JWT, error) {
+	return retry(ctx, r, func() (*JWT, error) { return r.Service.LoginClient(ctx, clientID, clientSecret, realm) })
+}
+
+func (r *RetryService) LoginAdmin(ctx context.Context, username string, password string, realm string) (*JWT, error) {
+	return retry(ctx, r, func() (*JWT, error) { return r.Service.LoginAdmin(ctx, username, password, realm) })
+}
+
+func (r *RetryService) GetToken(ctx context.Context, realm string, options TokenOptions) (*JWT, error) {
+	return retry(ctx, r, func() (*JWT, error) { return r.Service.GetToken(ctx, realm, options) })
+}
+
+func (r *RetryService) ExchangeToken(ctx context.Context, realm string, options TokenOptions) (*JWT, error) {
+	return retry(ctx, r, func() (*JWT, error) { return r.Service.ExchangeToken(ctx, realm, options) })
+}
+
+func (r *RetryService) GetClients(ctx context.Context, token string, realm string, params GetClientsParams) ([]*Client, error) {
+	return retry(ctx, r, func() ([]*Client, error) { return r.Service.GetClients(ctx, token, realm, params) })
+}
+
+func (r *RetryService) GetClientSecret(ctx context.Context, token string, realm string, clientID string) (*CredentialRepresentation, error) {
+	return retry(ctx, r, func() (*CredentialRepresentation, error) {
+		return r.Service.GetClientSecret(ctx, token, realm, clientID)
+	})
+}
+
+func (r *RetryService) GetClientRotatedSecret(ctx context.Context, token string, realm string, clientID string) (*CredentialRepresentation, error) {
+	return retry(ctx, r, func() (*CredentialRepresentation, error) {
+		return r.Service.GetClientRotatedSecret(ctx, token, realm, clientID)
+	})
+}
+
+func (r *RetryService) GetClientServiceAccount(ctx context.Context, token string, realm string, clientID string) (*User, error) {
+	return retry(ctx, r, func() (*User, error) { return r.Service.GetClientServiceAccount(ctx, token, realm, clientID) })
+}
+
+func (r *RetryService) GetRealmRole(ctx context.Context, token string, realm string, roleName string) (*Role, error) {
+	return retry(ctx, r, func() (*Role, error) { return r.Service.GetRealmRole(ctx, token, realm, roleName) })
+}
+
+func (r *RetryService) GetClientRole(ctx context.Context, token string, realm string, clientID string, roleName string) (*Role, error) {
+	return retry(ctx, r, func() (*Role, error) { return r.Service.GetClientRole(ctx, token, realm, clientID, roleName) })
+}
+
+func (r *RetryService) GetGroupByPath(ctx context.Context, token string, realm string, groupPath string) (*Group, error) {
+	return retry(ctx, r, func() (*Group, error) { return r.Service.GetGroupByPath(ctx, token, realm, groupPath) })
+}
+
+func (r *RetryService) GetWellKnownOpenidConfiguration(ctx context.Context, realm string) (*WellKnownOpenidConfiguration, error) {
+	return retry(ctx, r, func() (*WellKnownOpenidConfiguration, error) {
+		return r.Service.GetWellKnownOpenidConfiguration(ctx, realm)
+	})
+}
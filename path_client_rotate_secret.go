@@ -0,0 +1,178 @@
+package keycloak
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathClientRotateSecret(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "clients/" + framework.GenericNameRegex("clientId") + "/rotate-secret",
+		Fields: map[string]*framework.FieldSchema{
+			"clientId": {
+				Type:        framework.TypeString,
+				Description: "Name of the client.",
+			},
+			"include_rotated_secret": {
+				Type:        framework.TypeBool,
+				Description: "Return the previous secret, which keycloak's client secret rotation policy keeps valid for a grace period. Whether it stays valid only depends on the policy.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathClientRotateSecretUpdate,
+		},
+	}
+}
+func (b *backend) pathClientRotateSecretUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	clientId := d.Get("clientId").(string)
+	if clientId == "" {
+		return logical.ErrorResponse("missing client"), nil
+	}
+
+	config, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return logical.ErrorResponse("failed to read config"), err
+	}
+	if err := config.checkClient(config.Realm, clientId); err != nil {
+		return accessDenied(err)
+	}
+
+	return b.rotateClientSecret(ctx, config.Realm, clientId, config, d.Get("include_rotated_secret").(bool))
+}
+
+func pathRealmClientRotateSecret(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "realms/" + framework.GenericNameRegex("realm") + "/clients/" + framework.GenericNameRegex("clientId") + "/rotate-secret",
+		Fields: map[string]*framework.FieldSchema{
+			"clientId": {
+				Type:        framework.TypeString,
+				Description: "Name of the client.",
+			},
+			"realm": {
+				Type:        framework.TypeString,
+				Description: "Name of the realm.",
+			},
+			"include_rotated_secret": {
+				Type:        framework.TypeBool,
+				Description: "Return the previous secret, which keycloak's client secret rotation policy keeps valid for a grace period. Whether it stays valid only depends on the policy.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRealmClientRotateSecretUpdate,
+		},
+	}
+}
+func (b *backend) pathRealmClientRotateSecretUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	realm := d.Get("realm").(string)
+	if realm == "" {
+		return logical.ErrorResponse("missing realm"), nil
+	}
+	clientId := d.Get("clientId").(string)
+	if clientId == "" {
+		return logical.ErrorResponse("missing client"), nil
+	}
+
+	config, err := readConfigForRequest(ctx, req.Storage, d, realm)
+	if err != nil {
+		return logical.ErrorResponse("failed to read config"), err
+	}
+	if err := config.checkClient(realm, clientId); err != nil {
+		return accessDenied(err)
+	}
+
+	return b.rotateClientSecret(ctx, realm, clientId, config, d.Get("include_rotated_secret").(bool))
+}
+
+func (b *backend) rotateClientSecret(ctx context.Context, realm string, clientId string, config ConnectionConfig, includeRotated bool) (*logical.Response, error) {
+	// rotating the connection's own client here would invalidate the secret that vault stored
+	if err := config.checkNotOwnClient(realm, clientId); err != nil {
+		return accessDenied(err)
+	}
+
+	clientSecret, err := b.regenerateClientSecretOfRealm(ctx, realm, clientId, config)
+	if err != nil {
+		return clientErrorResponse("could not rotate client secret", err)
+	}
+	b.logger.Info("rotated client secret", "realm", realm, "client_id", clientId)
+
+	// From here on, the new secret is the only valid one, so it is returned
+	// even if further lookups fail.
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"client_secret": clientSecret,
+			"client_id":     clientId,
+		},
+	}
+
+	openidConfig, err := b.getGetWellKnownOpenidConfiguration(ctx, config, realm)
+	if err != nil {
+		b.logger.Warn("rotated client secret, but could not retrieve issuer", "realm", realm, "client_id", clientId, "error", err)
+		response.AddWarning("could not retrieve issuer: " + err.Error())
+		response.Data["issuer"] = ""
+	} else {
+		response.Data["issuer"] = openidConfig.Issuer
+	}
+
+	if includeRotated {
+		rotated, err := b.readRotatedSecretOfRealm(ctx, realm, clientId, config)
+		if err != nil {
+			b.logger.Warn("rotated client secret, but could not retrieve the rotated secret", "realm", realm, "client_id", clientId, "error", err)
+			response.AddWarning("could not retrieve rotated client secret: " + err.Error())
+			return response, nil
+		}
+		if rotated == nil {
+			response.AddWarning("keycloak did not keep the previous client secret, the client secret rotation policy is probably not enabled for the client")
+		}
+		rotated.addTo(response.Data)
+	}
+
+	return response, nil
+}
+
+// readRotatedSecretOfRealm looks up the client again, as regenerating the
+// secret updates the attributes that describe the rotated secret.
+func (b *backend) readRotatedSecretOfRealm(ctx context.Context, realm string, clientId string, config ConnectionConfig) (*rotatedSecret, error) {
+	goclaokClient, token, err := b.getClientAndAccessToken(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := findClient(ctx, goclaokClient, token, realm, clientId)
+	if err != nil {
+		return nil, err
+	}
+
+	return readRotatedSecret(ctx, goclaokClient, token, realm, client)
+}
+
+// regenerateClientSecretOfRealm lets keycloak generate a new secret for the client and returns it.
+// The previous secret becomes invalid, unless keycloak's client secret rotation policy keeps it.
+func (b *backend) regenerateClientSecretOfRealm(ctx context.Context, realm string, clientId string, config ConnectionConfig) (string, error) {
+	goclaokClient, token, err := b.getClientAndAccessToken(ctx, config)
+	if err != nil {
+		return "", err
+	}
+
+	client, err := findClient(ctx, goclaokClient, token, realm, clientId)
+	if err != nil {
+		return "", err
+	}
+	if err := config.checkClientAttribute(clientId, client); err != nil {
+		return "", err
+	}
+
+	creds, err := goclaokClient.RegenerateClientSecret(ctx, token.AccessToken, realm, *client.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to regenerate client secret: %w", err)
+	}
+	if creds == nil || creds.Value == nil || *creds.Value == "" {
+		return "", fmt.Errorf("keycloak returned no client secret for %s", clientId)
+	}
+
+	return *creds.Value, nil
+}
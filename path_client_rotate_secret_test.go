@@ -0,0 +1,268 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_RotateClientSecret(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := &keycloak.MockService{}
+
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "somerealm").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+
+	requestedClientId := "myclient"
+	idOfRequestedClient := "123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "somerealm", keycloak.GetClientsParams{
+		ClientID: &requestedClientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfRequestedClient,
+		},
+	}, nil)
+	secretValue := "mynewsecret456"
+	gocloakClientMock.On("RegenerateClientSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	gocloakClientMock.On("GetWellKnownOpenidConfiguration", mock.Anything, "somerealm").Return(&keycloak.WellKnownOpenidConfiguration{
+		Issuer: "THIS_IS_THE_ISSUER",
+	}, nil)
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	})
+
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	rotateClientSecretReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "clients/" + requestedClientId + "/rotate-secret",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(context.Background(), rotateClientSecretReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	expectedResponse := map[string]interface{}{
+		"client_secret": "mynewsecret456",
+		"client_id":     "myclient",
+		"issuer":        "THIS_IS_THE_ISSUER",
+	}
+
+	if !reflect.DeepEqual(resp.Data, expectedResponse) {
+		t.Fatalf("Expected: %#v\nActual: %#v", expectedResponse, resp.Data)
+	}
+}
+
+func TestBackend_RotateClientSecretForRealm(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := &keycloak.MockService{}
+
+	gocloakClientMock.On("LoginClient", mock.Anything, "vaultforrealm", "vaultforrealm_secret123", "somerealm").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+
+	requestedClientId := "myclient"
+	idOfRequestedClient := "123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "somerealm", keycloak.GetClientsParams{
+		ClientID: &requestedClientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfRequestedClient,
+		},
+	}, nil)
+	secretValue := "mynewsecret456"
+	gocloakClientMock.On("RegenerateClientSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	gocloakClientMock.On("GetWellKnownOpenidConfiguration", mock.Anything, "somerealm").Return(&keycloak.WellKnownOpenidConfiguration{
+		Issuer: "THIS_IS_THE_ISSUER",
+	}, nil)
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	writeConfigForKey(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vaultforrealm",
+		ClientSecret: "vaultforrealm_secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	}, "config/realms/somerealm/connection")
+
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	rotateClientSecretReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "realms/somerealm/clients/" + requestedClientId + "/rotate-secret",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(context.Background(), rotateClientSecretReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	expectedResponse := map[string]interface{}{
+		"client_secret": "mynewsecret456",
+		"client_id":     "myclient",
+		"issuer":        "THIS_IS_THE_ISSUER",
+	}
+
+	if !reflect.DeepEqual(resp.Data, expectedResponse) {
+		t.Fatalf("Expected: %#v\nActual: %#v", expectedResponse, resp.Data)
+	}
+}
+
+func TestBackend_RotateClientSecretFails(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := &keycloak.MockService{}
+
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "somerealm").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+
+	requestedClientId := "myclient"
+	idOfRequestedClient := "123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "another-realm", keycloak.GetClientsParams{
+		ClientID: &requestedClientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfRequestedClient,
+		},
+	}, nil)
+	gocloakClientMock.On("RegenerateClientSecret", mock.Anything, "access123", "another-realm", idOfRequestedClient).Return(nil, errors.New("403 Forbidden"))
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	})
+
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	rotateClientSecretReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "realms/another-realm/clients/" + requestedClientId + "/rotate-secret",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(context.Background(), rotateClientSecretReq)
+	if err == nil || (resp == nil || !resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+}
+
+func TestBackend_RotateClientSecretRejectsOwnClient(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+	gocloakClientMock := &keycloak.MockService{}
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	require.NoError(t, writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	}))
+
+	for _, path := range []string{"clients/vault/rotate-secret", "realms/somerealm/clients/vault/rotate-secret"} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   config.StorageView,
+		})
+		require.ErrorIs(t, err, logical.ErrPermissionDenied)
+		require.True(t, resp.IsError())
+		require.Contains(t, resp.Error().Error(), "config/rotate-root")
+	}
+	gocloakClientMock.AssertNotCalled(t, "RegenerateClientSecret", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBackend_RotateClientSecretReturnsSecretIfIssuerFails(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "somerealm").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	requestedClientId := "myclient"
+	idOfRequestedClient := "123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "somerealm", keycloak.GetClientsParams{
+		ClientID: &requestedClientId,
+	}).Return([]*keycloak.Client{{ID: &idOfRequestedClient}}, nil)
+	secretValue := "mynewsecret456"
+	gocloakClientMock.On("RegenerateClientSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	gocloakClientMock.On("GetWellKnownOpenidConfiguration", mock.Anything, "somerealm").Return(nil, errors.New("Keycloak not available"))
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	require.NoError(t, writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	}))
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "clients/myclient/rotate-secret",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, "mynewsecret456", resp.Data["client_secret"])
+	require.Len(t, resp.Warnings, 1)
+}
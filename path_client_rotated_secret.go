@@ -0,0 +1,157 @@
+package keycloak
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Client attributes that keycloak's client secret rotation policy maintains.
+const (
+	clientAttributeRotatedSecret           = "client.secret.rotated"
+	clientAttributeRotatedSecretExpiration = "client.secret.rotated.expiration.time"
+)
+
+func pathClientInvalidateRotatedSecret(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "clients/" + framework.GenericNameRegex("clientId") + "/invalidate-rotated-secret",
+		Fields: map[string]*framework.FieldSchema{
+			"clientId": {
+				Type:        framework.TypeString,
+				Description: "Name of the client.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathClientInvalidateRotatedSecretUpdate,
+		},
+	}
+}
+func (b *backend) pathClientInvalidateRotatedSecretUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	clientId := d.Get("clientId").(string)
+	if clientId == "" {
+		return logical.ErrorResponse("missing client"), nil
+	}
+
+	config, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return logical.ErrorResponse("failed to read config"), err
+	}
+	if err := config.checkClient(config.Realm, clientId); err != nil {
+		return accessDenied(err)
+	}
+
+	return b.invalidateRotatedSecret(ctx, config.Realm, clientId, config)
+}
+
+func pathRealmClientInvalidateRotatedSecret(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "realms/" + framework.GenericNameRegex("realm") + "/clients/" + framework.GenericNameRegex("clientId") + "/invalidate-rotated-secret",
+		Fields: map[string]*framework.FieldSchema{
+			"clientId": {
+				Type:        framework.TypeString,
+				Description: "Name of the client.",
+			},
+			"realm": {
+				Type:        framework.TypeString,
+				Description: "Name of the realm.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRealmClientInvalidateRotatedSecretUpdate,
+		},
+	}
+}
+func (b *backend) pathRealmClientInvalidateRotatedSecretUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	realm := d.Get("realm").(string)
+	if realm == "" {
+		return logical.ErrorResponse("missing realm"), nil
+	}
+	clientId := d.Get("clientId").(string)
+	if clientId == "" {
+		return logical.ErrorResponse("missing client"), nil
+	}
+
+	config, err := readConfigForRequest(ctx, req.Storage, d, realm)
+	if err != nil {
+		return logical.ErrorResponse("failed to read config"), err
+	}
+	if err := config.checkClient(realm, clientId); err != nil {
+		return accessDenied(err)
+	}
+
+	return b.invalidateRotatedSecret(ctx, realm, clientId, config)
+}
+
+func (b *backend) invalidateRotatedSecret(ctx context.Context, realm string, clientId string, config ConnectionConfig) (*logical.Response, error) {
+	goclaokClient, token, err := b.getClientAndAccessToken(ctx, config)
+	if err != nil {
+		return logical.ErrorResponse("failed to access keycloak"), err
+	}
+
+	client, err := findClient(ctx, goclaokClient, token, realm, clientId)
+	if err == nil {
+		err = config.checkClientAttribute(clientId, client)
+	}
+	if err != nil {
+		return clientErrorResponse("could not find client", err)
+	}
+
+	if err := goclaokClient.InvalidateClientRotatedSecret(ctx, token.AccessToken, realm, *client.ID); err != nil {
+		return logical.ErrorResponse("could not invalidate rotated client secret"), err
+	}
+	b.logger.Info("invalidated rotated client secret", "realm", realm, "client_id", clientId)
+
+	return nil, nil
+}
+
+// rotatedSecret is the previous secret of a client that stays valid until Expiration.
+type rotatedSecret struct {
+	Value      string
+	Expiration time.Time
+}
+
+// readRotatedSecret returns the rotated secret of client or nil, if keycloak
+// does not keep one for it.
+func readRotatedSecret(ctx context.Context, goclaokClient keycloak.Service, token *keycloak.JWT, realm string, client *keycloak.Client) (*rotatedSecret, error) {
+	if client.Attributes == nil {
+		return nil, nil
+	}
+	attributes := *client.Attributes
+	if _, ok := attributes[clientAttributeRotatedSecret]; !ok {
+		return nil, nil
+	}
+
+	creds, err := goclaokClient.GetClientRotatedSecret(ctx, token.AccessToken, realm, *client.ID)
+	if keycloak.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if creds == nil || creds.Value == nil {
+		return nil, nil
+	}
+
+	secret := &rotatedSecret{Value: *creds.Value}
+	if expiration, err := strconv.ParseInt(attributes[clientAttributeRotatedSecretExpiration], 10, 64); err == nil {
+		secret.Expiration = time.Unix(expiration, 0).UTC()
+	}
+	return secret, nil
+}
+
+// addTo adds the rotated secret to the data of a response.
+func (s *rotatedSecret) addTo(data map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	data["rotated_secret"] = s.Value
+	if !s.Expiration.IsZero() {
+		data["rotated_secret_expiration"] = s.Expiration
+	}
+}
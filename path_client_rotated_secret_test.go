@@ -0,0 +1,314 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func mockedGocloakWithRotatedSecret() *keycloak.MockService {
+	gocloakClientMock := &keycloak.MockService{}
+
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "somerealm").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+
+	requestedClientId := "myclient"
+	idOfRequestedClient := "123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "somerealm", keycloak.GetClientsParams{
+		ClientID: &requestedClientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfRequestedClient,
+			Attributes: &map[string]string{
+				"client.secret.rotated":                 "myoldsecret123",
+				"client.secret.rotated.expiration.time": "1700000000",
+			},
+		},
+	}, nil)
+	secretValue := "mysecret456"
+	gocloakClientMock.On("GetClientSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	gocloakClientMock.On("RegenerateClientSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	rotatedSecretValue := "myoldsecret123"
+	gocloakClientMock.On("GetClientRotatedSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &rotatedSecretValue,
+	}, nil)
+	gocloakClientMock.On("InvalidateClientRotatedSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(nil)
+	gocloakClientMock.On("GetWellKnownOpenidConfiguration", mock.Anything, "somerealm").Return(&keycloak.WellKnownOpenidConfiguration{
+		Issuer: "THIS_IS_THE_ISSUER",
+	}, nil)
+
+	return gocloakClientMock
+}
+
+func TestBackend_ReadClientSecretWithRotatedSecret(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(mockedGocloakWithRotatedSecret())
+
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	})
+
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	readSecretReq := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "realms/somerealm/clients/myclient/secret",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(context.Background(), readSecretReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	expectedResponse := map[string]interface{}{
+		"client_secret":             "mysecret456",
+		"client_id":                 "myclient",
+		"issuer":                    "THIS_IS_THE_ISSUER",
+		"rotated_secret":            "myoldsecret123",
+		"rotated_secret_expiration": time.Unix(1700000000, 0).UTC(),
+	}
+
+	if !reflect.DeepEqual(resp.Data, expectedResponse) {
+		t.Fatalf("Expected: %#v\nActual: %#v", expectedResponse, resp.Data)
+	}
+}
+
+func TestBackend_RotateClientSecretKeepingRotatedSecret(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(mockedGocloakWithRotatedSecret())
+
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	})
+
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	rotateClientSecretReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "clients/myclient/rotate-secret",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"include_rotated_secret": true,
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), rotateClientSecretReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	expectedResponse := map[string]interface{}{
+		"client_secret":             "mysecret456",
+		"client_id":                 "myclient",
+		"issuer":                    "THIS_IS_THE_ISSUER",
+		"rotated_secret":            "myoldsecret123",
+		"rotated_secret_expiration": time.Unix(1700000000, 0).UTC(),
+	}
+
+	if !reflect.DeepEqual(resp.Data, expectedResponse) {
+		t.Fatalf("Expected: %#v\nActual: %#v", expectedResponse, resp.Data)
+	}
+}
+
+func TestBackend_InvalidateRotatedSecret(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := mockedGocloakWithRotatedSecret()
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	})
+
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	invalidateReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "realms/somerealm/clients/myclient/invalidate-rotated-secret",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(context.Background(), invalidateReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	gocloakClientMock.AssertCalled(t, "InvalidateClientRotatedSecret", mock.Anything, "access123", "somerealm", "123")
+}
+
+func TestBackend_InvalidateRotatedSecretRequiresClientAttribute(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+
+	gocloakClientMock := mockedGocloakWithRotatedSecret()
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	require.NoError(t, writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+		AccessConfig: AccessConfig{RequireClientAttribute: "vault.managed=true"},
+	}))
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "realms/somerealm/clients/myclient/invalidate-rotated-secret",
+		Storage:   config.StorageView,
+	})
+	require.ErrorIs(t, err, logical.ErrPermissionDenied)
+	require.True(t, resp.IsError())
+	gocloakClientMock.AssertNotCalled(t, "InvalidateClientRotatedSecret", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBackend_RotateClientSecretReturnsSecretIfRotatedSecretFails(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "somerealm").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	requestedClientId := "myclient"
+	idOfRequestedClient := "123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "somerealm", keycloak.GetClientsParams{
+		ClientID: &requestedClientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID:         &idOfRequestedClient,
+			Attributes: &map[string]string{"client.secret.rotated": "myoldsecret123"},
+		},
+	}, nil)
+	secretValue := "mysecret456"
+	gocloakClientMock.On("RegenerateClientSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	gocloakClientMock.On("GetClientRotatedSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(nil, errors.New("Keycloak not available"))
+	gocloakClientMock.On("GetWellKnownOpenidConfiguration", mock.Anything, "somerealm").Return(&keycloak.WellKnownOpenidConfiguration{
+		Issuer: "THIS_IS_THE_ISSUER",
+	}, nil)
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	require.NoError(t, writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	}))
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "clients/myclient/rotate-secret",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"include_rotated_secret": true,
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, "mysecret456", resp.Data["client_secret"])
+	require.NotContains(t, resp.Data, "rotated_secret")
+	require.Len(t, resp.Warnings, 1)
+}
+
+func TestBackend_ReadClientSecretIfRotatedSecretFails(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "somerealm").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	requestedClientId := "myclient"
+	idOfRequestedClient := "123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "somerealm", keycloak.GetClientsParams{
+		ClientID: &requestedClientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID:         &idOfRequestedClient,
+			Attributes: &map[string]string{"client.secret.rotated": "myoldsecret123"},
+		},
+	}, nil)
+	secretValue := "mysecret456"
+	gocloakClientMock.On("GetClientSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	gocloakClientMock.On("GetClientRotatedSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(nil, errors.New("403 Forbidden"))
+	gocloakClientMock.On("GetWellKnownOpenidConfiguration", mock.Anything, "somerealm").Return(&keycloak.WellKnownOpenidConfiguration{
+		Issuer: "THIS_IS_THE_ISSUER",
+	}, nil)
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	require.NoError(t, writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	}))
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "realms/somerealm/clients/myclient/secret",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, "mysecret456", resp.Data["client_secret"])
+	require.NotContains(t, resp.Data, "rotated_secret")
+	require.Len(t, resp.Warnings, 1)
+}
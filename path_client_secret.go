@@ -3,6 +3,8 @@ package keycloak
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
@@ -38,10 +40,13 @@ func (b *backend) pathClientSecretReadDeprecated(ctx context.Context, req *logic
 	if err != nil {
 		return logical.ErrorResponse("failed to read config"), err
 	}
+	if err := config.checkClient(config.Realm, clientId); err != nil {
+		return accessDenied(err)
+	}
 
 	clientSecret, err := b.readClientSecret(ctx, clientId, config)
 	if err != nil {
-		return logical.ErrorResponse("could not retrieve client secret"), err
+		return clientErrorResponse("could not retrieve client secret", err)
 	}
 
 	// Generate the response
@@ -64,6 +69,10 @@ func pathClientSecret(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "Name of the client.",
 			},
+			"include_discovery": {
+				Type:        framework.TypeBool,
+				Description: includeDiscoveryDescription,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -82,10 +91,13 @@ func (b *backend) pathClientSecretRead(ctx context.Context, req *logical.Request
 	if err != nil {
 		return logical.ErrorResponse("failed to read config"), err
 	}
+	if err := config.checkClient(config.Realm, clientId); err != nil {
+		return accessDenied(err)
+	}
 
-	clientSecret, err := b.readClientSecret(ctx, clientId, config)
+	creds, err := b.readClientCredentialsOfRealm(ctx, config.Realm, clientId, config)
 	if err != nil {
-		return logical.ErrorResponse("could not retrieve client secret"), err
+		return clientErrorResponse("could not retrieve client secret", err)
 	}
 
 	openIdConifg, err := b.getGetWellKnownOpenidConfiguration(ctx, config, config.Realm)
@@ -96,17 +108,24 @@ func (b *backend) pathClientSecretRead(ctx context.Context, req *logical.Request
 	// Generate the response
 	response := &logical.Response{
 		Data: map[string]interface{}{
-			"client_secret": clientSecret,
+			"client_secret": creds.secret,
 			"client_id":     clientId,
 			"issuer":        openIdConifg.Issuer,
 		},
 	}
+	creds.addRotatedTo(response)
+	if d.Get("include_discovery").(bool) {
+		addDiscovery(response.Data, openIdConifg)
+	}
 
 	return response, nil
 }
 
 func (b *backend) getGetWellKnownOpenidConfiguration(ctx context.Context, config ConnectionConfig, realm string) (*keycloak.WellKnownOpenidConfiguration, error) {
-	client := b.KeycloakServiceFactory(config.ServerUrl)
+	client, err := b.keycloakService(config)
+	if err != nil {
+		return nil, err
+	}
 	return client.GetWellKnownOpenidConfiguration(ctx, realm)
 }
 
@@ -115,53 +134,269 @@ func (b *backend) readClientSecret(ctx context.Context, clientId string, config
 	return b.readClientSecretOfRealm(ctx, config.Realm, clientId, config)
 }
 func (b *backend) readClientSecretOfRealm(ctx context.Context, realm string, clientId string, config ConnectionConfig) (string, error) {
+	creds, err := b.readClientCredentialsOfRealm(ctx, realm, clientId, config)
+	if err != nil {
+		return "", err
+	}
+	return creds.secret, nil
+}
+
+// clientCredentials are the current secret of a client and, during a
+// rotation, the previous one.
+type clientCredentials struct {
+	secret  string
+	rotated *rotatedSecret
+	// rotatedErr is why the rotated secret could not be read, which does not
+	// fail the read of the current secret.
+	rotatedErr error
+}
+
+// addRotatedTo adds the rotated secret to response, or a warning if it could not be read.
+func (c *clientCredentials) addRotatedTo(response *logical.Response) {
+	if c.rotatedErr != nil {
+		response.AddWarning("could not retrieve rotated client secret: " + c.rotatedErr.Error())
+		return
+	}
+	c.rotated.addTo(response.Data)
+}
+
+func (b *backend) readClientCredentialsOfRealm(ctx context.Context, realm string, clientId string, config ConnectionConfig) (*clientCredentials, error) {
 
 	goclaokClient, token, err := b.getClientAndAccessToken(ctx, config)
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
+	client, err := findClient(ctx, goclaokClient, token, realm, clientId)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.checkClientAttribute(clientId, client); err != nil {
+		return nil, err
+	}
+
+	creds, err := goclaokClient.GetClientSecret(ctx, token.AccessToken, realm, *client.ID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rotated, err := readRotatedSecret(ctx, goclaokClient, token, realm, client)
+	if err != nil {
+		b.logger.Warn("could not retrieve the rotated client secret", "realm", realm, "client_id", clientId, "error", err)
+	}
+
+	return &clientCredentials{secret: *creds.Value, rotated: rotated, rotatedErr: err}, nil
+}
+
+// findClient looks up the client with the (human readable) clientId in realm.
+// Exactly one client has to match.
+func findClient(ctx context.Context, goclaokClient keycloak.Service, token *keycloak.JWT, realm string, clientId string) (*keycloak.Client, error) {
 	clients, err := goclaokClient.GetClients(ctx, token.AccessToken, realm, keycloak.GetClientsParams{
 		ClientID: &clientId,
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if len(clients) != 1 {
-		return "", fmt.Errorf("found %d clients for %s", len(clients), clientId)
+		return nil, fmt.Errorf("found %d clients for %s", len(clients), clientId)
 	}
 
-	client := clients[0]
+	return clients[0], nil
+}
 
-	creds, err := goclaokClient.GetClientSecret(ctx, token.AccessToken, realm, *client.ID)
+// keycloakService creates a [keycloak.Service] that connects to keycloak as
+// configured by config.
+func (b *backend) keycloakService(config ConnectionConfig) (keycloak.Service, error) {
+	if len(config.FailoverUrls) == 0 {
+		goclaokClient, err := b.endpointService(config, config.adminURL())
+		if err != nil {
+			return nil, err
+		}
+		return config.withRetries(goclaokClient), nil
+	}
+
+	endpoints := b.endpointsOf(append([]string{config.adminURL()}, config.FailoverUrls...))
+	services := make([]keycloak.Service, 0, len(endpoints.URLs()))
+	for _, endpoint := range endpoints.URLs() {
+		goclaokClient, err := b.endpointService(config, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, goclaokClient)
+	}
+	// a call is only retried once all endpoints failed
+	return config.withRetries(keycloak.NewFailoverService(endpoints, services, b.tokenSource(config))), nil
+}
 
+// endpointService creates a [keycloak.Service] that connects to one of the
+// endpoints of config, without failing over to the others.
+func (b *backend) endpointService(config ConnectionConfig, endpoint string) (keycloak.Service, error) {
+	options := config.serviceOptions()
+	options.PublicURL = config.ServerUrl
+	// without admin_url, the failover urls replace the public url as well
+	if config.AdminUrl == "" {
+		options.PublicURL = endpoint
+	}
+	goclaokClient, err := b.KeycloakServiceFactory(endpoint, options)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("invalid connection settings: %w", err)
+	}
+	return goclaokClient, nil
+}
+
+// checkFailoverUrls logs in at each failover url of config, so that a wrong
+// one shows up when it is configured rather than during an outage.
+func (b *backend) checkFailoverUrls(ctx context.Context, config ConnectionConfig) error {
+	for _, endpoint := range config.FailoverUrls {
+		goclaokClient, err := b.endpointService(config, endpoint)
+		if err != nil {
+			return err
+		}
+		if _, err := b.login(ctx, config.withRetries(goclaokClient), config); err != nil {
+			return fmt.Errorf("failed to login at %s: %w", endpoint, err)
+		}
+	}
+	return nil
+}
+
+// endpointsOf returns the health of the endpoints with the given urls, which
+// is shared by all connections that use the same urls.
+func (b *backend) endpointsOf(urls []string) *keycloak.Endpoints {
+	b.endpointsMutex.Lock()
+	defer b.endpointsMutex.Unlock()
+
+	key := strings.Join(urls, " ")
+	endpoints, ok := b.endpoints[key]
+	if !ok {
+		endpoints = keycloak.NewEndpoints(urls)
+		b.endpoints[key] = endpoints
 	}
+	return endpoints
+}
 
-	return *creds.Value, nil
+// cachedToken is an access token along with the endpoint that issued it, as
+// keycloak sites that fail over to each other may not accept each other's tokens.
+type cachedToken struct {
+	token    *keycloak.JWT
+	endpoint string
 }
 
 func (b *backend) getClientAndAccessToken(ctx context.Context, config ConnectionConfig) (keycloak.Service, *keycloak.JWT, error) {
-	goclaokClient := b.KeycloakServiceFactory(config.ServerUrl)
+	goclaokClient, err := b.keycloakService(config)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	b.jwtMutex.Lock()
-	defer b.jwtMutex.Unlock()
+	unlock := b.lockLogin(config)
+	defer unlock()
 
-	if token, ok := b.jwt[config]; ok && jwt.IsValidIn(token.AccessToken, time.Duration(5)*time.Second) {
+	if token := b.cachedAccessToken(config, keycloak.EndpointOf(goclaokClient)); token != nil {
 		return goclaokClient, token, nil
 	}
 
-	token, err := goclaokClient.LoginClient(ctx, config.ClientId, config.ClientSecret, config.Realm)
+	token, err := b.login(ctx, goclaokClient, config)
+	b.recordLogin(config, err)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to login: %w", err)
 	}
 
-	b.jwt[config] = token
+	// the login may have failed over to another endpoint
+	b.cacheAccessToken(config, token, keycloak.EndpointOf(goclaokClient))
 	return goclaokClient, token, nil
 }
 
+// tokenSource returns the access tokens of config at the endpoints that admin
+// calls fail over to. Only one token is cached per connection, so that the
+// token of an endpoint that was left is not used once it is returned to.
+func (b *backend) tokenSource(config ConnectionConfig) keycloak.TokenSource {
+	return func(ctx context.Context, url string, service keycloak.Service) (string, error) {
+		unlock := b.lockLogin(config)
+		defer unlock()
+
+		if token := b.cachedAccessToken(config, url); token != nil {
+			return token.AccessToken, nil
+		}
+
+		token, err := b.login(ctx, service, config)
+		b.recordLogin(config, err)
+		if err != nil {
+			return "", fmt.Errorf("failed to login: %w", err)
+		}
+		b.cacheAccessToken(config, token, url)
+		return token.AccessToken, nil
+	}
+}
+
+// lockLogin serializes the logins of config and returns the function that
+// releases them. Each connection is locked on its own, so that a connection
+// whose keycloak is unreachable does not hold up the logins of the others
+// while it retries.
+func (b *backend) lockLogin(config ConnectionConfig) func() {
+	b.jwtMutex.Lock()
+	mutex, ok := b.loginMutexes[config.key()]
+	if !ok {
+		mutex = &sync.Mutex{}
+		b.loginMutexes[config.key()] = mutex
+	}
+	b.jwtMutex.Unlock()
+
+	mutex.Lock()
+	return mutex.Unlock
+}
+
+// cachedAccessToken returns the cached access token of config if endpoint
+// issued it and it is still valid.
+func (b *backend) cachedAccessToken(config ConnectionConfig, endpoint string) *keycloak.JWT {
+	b.jwtMutex.Lock()
+	defer b.jwtMutex.Unlock()
+
+	cached, ok := b.jwt[config.key()]
+	if ok && cached.endpoint == endpoint && jwt.IsValidIn(cached.token.AccessToken, time.Duration(5)*time.Second) {
+		return cached.token
+	}
+	return nil
+}
+
+func (b *backend) cacheAccessToken(config ConnectionConfig, token *keycloak.JWT, endpoint string) {
+	b.jwtMutex.Lock()
+	defer b.jwtMutex.Unlock()
+
+	b.jwt[config.key()] = cachedToken{token: token, endpoint: endpoint}
+}
+
+// login authenticates the client of config with its auth method. Client
+// assertions are created anew for each login, and each attempt of it, so that
+// they never expire before the access token that is cached and are never
+// replayed.
+func (b *backend) login(ctx context.Context, goclaokClient keycloak.Service, config ConnectionConfig) (*keycloak.JWT, error) {
+	switch config.authMethod() {
+	case authMethodClientSecret:
+		return goclaokClient.LoginClient(ctx, config.ClientId, config.ClientSecret, config.Realm)
+	case authMethodPassword:
+		return goclaokClient.LoginAdmin(ctx, config.Username, config.Password, config.loginRealm())
+	}
+
+	return keycloak.Repeat(ctx, goclaokClient, func(service keycloak.Service) (*keycloak.JWT, error) {
+		assertion, err := b.clientAssertion(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		return service.LoginClientAssertion(ctx, config.ClientId, assertion, config.Realm)
+	})
+}
+
+// forgetAccessToken drops the cached access token of config, e.g. after its
+// credentials have been replaced.
+func (b *backend) forgetAccessToken(config ConnectionConfig) {
+	b.jwtMutex.Lock()
+	defer b.jwtMutex.Unlock()
+
+	delete(b.jwt, config.key())
+	delete(b.loginMutexes, config.key())
+}
+
 func pathRealmClientSecret(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "realms/" + framework.GenericNameRegex("realm") + "/clients/" + framework.GenericNameRegex("clientId") + "/secret",
@@ -174,6 +409,10 @@ func pathRealmClientSecret(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "Name of the realm.",
 			},
+			"include_discovery": {
+				Type:        framework.TypeBool,
+				Description: includeDiscoveryDescription,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -191,21 +430,17 @@ func (b *backend) pathRealmClientSecretRead(ctx context.Context, req *logical.Re
 		return logical.ErrorResponse("missing client"), nil
 	}
 
-	config, err := readConfigForKey(ctx, req.Storage, fmt.Sprintf(storagePerRealmKey, realm))
+	config, err := readConfigForRequest(ctx, req.Storage, d, realm)
 	if err != nil {
 		return logical.ErrorResponse("failed to read config"), err
 	}
-	// if config is empty, try to read the default config
-	if config.ServerUrl == "" {
-		config, err = readConfig(ctx, req.Storage)
-		if err != nil {
-			return logical.ErrorResponse("failed to read config"), err
-		}
+	if err := config.checkClient(realm, clientId); err != nil {
+		return accessDenied(err)
 	}
 
-	clientSecret, err := b.readClientSecretOfRealm(ctx, realm, clientId, config)
+	creds, err := b.readClientCredentialsOfRealm(ctx, realm, clientId, config)
 	if err != nil {
-		return logical.ErrorResponse("could not retrieve client secret"), err
+		return clientErrorResponse("could not retrieve client secret", err)
 	}
 
 	openidConfig, err := b.getGetWellKnownOpenidConfiguration(ctx, config, realm)
@@ -217,11 +452,15 @@ func (b *backend) pathRealmClientSecretRead(ctx context.Context, req *logical.Re
 	issuerUrl := openidConfig.Issuer
 	response := &logical.Response{
 		Data: map[string]interface{}{
-			"client_secret": clientSecret,
+			"client_secret": creds.secret,
 			"client_id":     clientId,
 			"issuer":        issuerUrl,
 		},
 	}
+	creds.addRotatedTo(response)
+	if d.Get("include_discovery").(bool) {
+		addDiscovery(response.Data, openidConfig)
+	}
 
 	return response, nil
 }
@@ -254,19 +493,16 @@ func (b *backend) pathRealmClientOptionalSecretRead(ctx context.Context, req *lo
 		return logical.ErrorResponse("missing client"), nil
 	}
 
-	config, err := readConfigForKey(ctx, req.Storage, fmt.Sprintf(storagePerRealmKey, realm))
+	config, err := readConfigForRequest(ctx, req.Storage, d, realm)
 	if err != nil {
 		return logical.ErrorResponse("failed to read config"), err
 	}
-	// if config is empty, try to read the default config
-	if config.ServerUrl == "" {
-		config, err = readConfig(ctx, req.Storage)
-		if err != nil {
-			return logical.ErrorResponse("failed to read config"), err
-		}
-	}
 
-	clientSecret, err := b.readClientSecretOfRealm(ctx, realm, clientId, config)
+	var clientSecret string
+	err = config.checkClient(realm, clientId)
+	if err == nil {
+		clientSecret, err = b.readClientSecretOfRealm(ctx, realm, clientId, config)
+	}
 	if err != nil {
 		message := fmt.Sprintf("could not retrieve client secret for client %s in realm %s: %s", clientId, realm, err.Error())
 		resp := &logical.Response{
@@ -718,3 +718,218 @@ func TestBackend_ReadOptionalClientSecretRetrunsNoErrorIfKeycloakIsNotAvailable2
 		t.Fatalf("Expected: %#v\nActual: %#v", expectedResponse, resp.Data)
 	}
 }
+
+func TestBackend_ReadClientSecretOnlyOfAllowedRealmsAndClients(t *testing.T) {
+	ctx := context.Background()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(ctx, config))
+
+	requestedClientId := "app-frontend"
+	idOfRequestedClient := "123"
+	secretValue := "mysecret123"
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "apps-prod", keycloak.GetClientsParams{
+		ClientID: &requestedClientId,
+	}).Return([]*keycloak.Client{{ID: &idOfRequestedClient}}, nil)
+	gocloakClientMock.On("GetClientSecret", mock.Anything, "access123", "apps-prod", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	gocloakClientMock.On("GetClientRotatedSecret", mock.Anything, "access123", "apps-prod", idOfRequestedClient).Return(nil, nil)
+	gocloakClientMock.On("GetWellKnownOpenidConfiguration", mock.Anything, "apps-prod").Return(&keycloak.WellKnownOpenidConfiguration{
+		Issuer: "http://auth.example.com/realms/apps-prod",
+	}, nil)
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url":         "http://auth.example.com",
+			"realm":              "master",
+			"client_id":          "vault",
+			"client_secret":      "secret123",
+			"allowed_realms":     "apps-*",
+			"allowed_client_ids": "app-*,broker",
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	for path, allowed := range map[string]bool{
+		"realms/apps-prod/clients/app-frontend/secret": true,
+		"realms/master/clients/app-frontend/secret":    false,
+		"realms/apps-prod/clients/grafana/secret":      false,
+		// built-in clients stay denied, even if allowed
+		"realms/apps-prod/clients/broker/secret": false,
+	} {
+		t.Run(path, func(t *testing.T) {
+			resp, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      path,
+				Storage:   config.StorageView,
+			})
+			if allowed {
+				require.NoError(t, err)
+				require.Equal(t, "mysecret123", resp.Data["client_secret"])
+				return
+			}
+			require.ErrorIs(t, err, logical.ErrPermissionDenied)
+			require.True(t, resp.IsError())
+		})
+	}
+	gocloakClientMock.AssertNumberOfCalls(t, "GetClients", 1)
+
+	// denying no client lifts the default
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.PatchOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"allowed_client_ids": "",
+			"denied_client_ids":  "",
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	stored, err := readConfig(ctx, config.StorageView)
+	require.NoError(t, err)
+	require.NoError(t, stored.checkClient("apps-prod", "broker"))
+	// the connection's own client is only protected from being rotated
+	require.NoError(t, stored.checkClient("apps-prod", "vault"))
+	require.Error(t, stored.checkNotOwnClient("master", "vault"))
+}
+
+func TestBackend_ReadClientSecretRequiresClientAttribute(t *testing.T) {
+	ctx := context.Background()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(ctx, config))
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	secretValue := "mysecret123"
+	for clientId, attributes := range map[string]map[string]string{
+		"managed":   {"vault.managed": "true"},
+		"unmarked":  {"vault.managed": "false"},
+		"unrelated": nil,
+	} {
+		id := "id-" + clientId
+		client := &keycloak.Client{ID: &id}
+		if attributes != nil {
+			client.Attributes = &attributes
+		}
+		gocloakClientMock.On("GetClients", mock.Anything, "access123", "master", keycloak.GetClientsParams{
+			ClientID: &clientId,
+		}).Return([]*keycloak.Client{client}, nil)
+		gocloakClientMock.On("GetClientSecret", mock.Anything, "access123", "master", id).Return(&keycloak.CredentialRepresentation{
+			Value: &secretValue,
+		}, nil)
+	}
+	gocloakClientMock.On("GetClientRotatedSecret", mock.Anything, "access123", "master", "id-managed").Return(nil, nil)
+	gocloakClientMock.On("GetWellKnownOpenidConfiguration", mock.Anything, "master").Return(&keycloak.WellKnownOpenidConfiguration{
+		Issuer: "http://auth.example.com/realms/master",
+	}, nil)
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url":               "http://auth.example.com",
+			"realm":                    "master",
+			"client_id":                "vault",
+			"client_secret":            "secret123",
+			"require_client_attribute": "vault.managed=true",
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "clients/managed/secret",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "mysecret123", resp.Data["client_secret"])
+
+	for _, clientId := range []string{"unmarked", "unrelated"} {
+		resp, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "clients/" + clientId + "/secret",
+			Storage:   config.StorageView,
+		})
+		require.ErrorIs(t, err, logical.ErrPermissionDenied)
+		require.Contains(t, resp.Error().Error(), "lacks the attribute vault.managed=true")
+	}
+	gocloakClientMock.AssertNotCalled(t, "GetClientSecret", mock.Anything, "access123", "master", "id-unmarked")
+	gocloakClientMock.AssertNotCalled(t, "GetClientSecret", mock.Anything, "access123", "master", "id-unrelated")
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.PatchOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"require_client_attribute": "vault.managed",
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+}
+
+func TestBackend_SlowLoginDoesNotBlockOtherConnections(t *testing.T) {
+	config := logical.TestBackendConfig()
+	b, err := newBackend(config)
+	require.NoError(t, err)
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "slow", "secret123", "realm1").Run(func(mock.Arguments) {
+		close(entered)
+		<-release
+	}).Return(&keycloak.JWT{AccessToken: testutil.JWT(time.Hour)}, nil).Once()
+	gocloakClientMock.On("LoginClient", mock.Anything, "fast", "secret123", "realm2").Return(&keycloak.JWT{
+		AccessToken: testutil.JWT(time.Hour),
+	}, nil).Once()
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	slowDone := make(chan error)
+	go func() {
+		_, _, err := b.getClientAndAccessToken(context.Background(), ConnectionConfig{
+			ServerUrl: "http://auth.example.com", Realm: "realm1", ClientId: "slow", ClientSecret: "secret123",
+		})
+		slowDone <- err
+	}()
+	<-entered
+
+	fastDone := make(chan error)
+	go func() {
+		_, _, err := b.getClientAndAccessToken(context.Background(), ConnectionConfig{
+			ServerUrl: "http://auth.example.com", Realm: "realm2", ClientId: "fast", ClientSecret: "secret123",
+		})
+		fastDone <- err
+	}()
+	select {
+	case err := <-fastDone:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the login of one connection waited for the login of another")
+	}
+
+	close(release)
+	require.NoError(t, <-slowDone)
+	gocloakClientMock.AssertExpectations(t)
+}
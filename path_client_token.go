@@ -0,0 +1,97 @@
+package keycloak
+
+import (
+	"context"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const grantTypeClientCredentials = "client_credentials"
+
+func pathRealmClientToken(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "realms/" + framework.GenericNameRegex("realm") + "/clients/" + framework.GenericNameRegex("clientId") + "/token",
+		Fields: map[string]*framework.FieldSchema{
+			"clientId": {
+				Type:        framework.TypeString,
+				Description: "Name of the client.",
+			},
+			"realm": {
+				Type:        framework.TypeString,
+				Description: "Name of the realm.",
+			},
+			"scope": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Scopes to request for the token.",
+			},
+			"audience": {
+				Type:        framework.TypeString,
+				Description: "Audience to request for the token.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathRealmClientTokenRead,
+		},
+	}
+}
+
+func (b *backend) pathRealmClientTokenRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	realm := d.Get("realm").(string)
+	if realm == "" {
+		return logical.ErrorResponse("missing realm"), nil
+	}
+	clientId := d.Get("clientId").(string)
+	if clientId == "" {
+		return logical.ErrorResponse("missing client"), nil
+	}
+
+	config, err := readConfigForRequest(ctx, req.Storage, d, realm)
+	if err != nil {
+		return logical.ErrorResponse("failed to read config"), err
+	}
+	if err := config.checkClient(realm, clientId); err != nil {
+		return accessDenied(err)
+	}
+
+	clientSecret, err := b.readClientSecretOfRealm(ctx, realm, clientId, config)
+	if err != nil {
+		return clientErrorResponse("could not retrieve client secret", err)
+	}
+
+	grantType := grantTypeClientCredentials
+	options := keycloak.TokenOptions{
+		ClientID:     &clientId,
+		ClientSecret: &clientSecret,
+		GrantType:    &grantType,
+	}
+	if scopes := d.Get("scope").([]string); len(scopes) > 0 {
+		options.Scopes = &scopes
+	}
+	if audience := d.Get("audience").(string); audience != "" {
+		options.Audience = &audience
+	}
+
+	goclaokClient, err := b.keycloakService(config)
+	if err != nil {
+		return logical.ErrorResponse("failed to access keycloak"), err
+	}
+	token, err := goclaokClient.GetToken(ctx, realm, options)
+	if err != nil {
+		return logical.ErrorResponse("could not retrieve token for client %s", clientId), err
+	}
+
+	// Generate the response, the client secret is intentionally not part of it
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"access_token": token.AccessToken,
+			"expires_in":   token.ExpiresIn,
+			"scope":        token.Scope,
+			"token_type":   token.TokenType,
+		},
+	}
+
+	return response, nil
+}
@@ -0,0 +1,151 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBackend_ReadClientToken(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := &keycloak.MockService{}
+
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "somerealm").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+
+	requestedClientId := "myclient"
+	idOfRequestedClient := "123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "somerealm", keycloak.GetClientsParams{
+		ClientID: &requestedClientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfRequestedClient,
+		},
+	}, nil)
+	secretValue := "mysecret123"
+	gocloakClientMock.On("GetClientSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	grantType := "client_credentials"
+	scopes := []string{"openid", "profile"}
+	audience := "other-service"
+	gocloakClientMock.On("GetToken", mock.Anything, "somerealm", keycloak.TokenOptions{
+		ClientID:     &requestedClientId,
+		ClientSecret: &secretValue,
+		GrantType:    &grantType,
+		Scopes:       &scopes,
+		Audience:     &audience,
+	}).Return(&keycloak.JWT{
+		AccessToken: "clientaccess456",
+		ExpiresIn:   300,
+		Scope:       "openid profile",
+		TokenType:   "Bearer",
+	}, nil)
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	})
+
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	readTokenReq := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "realms/somerealm/clients/" + requestedClientId + "/token",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"scope":    "openid,profile",
+			"audience": "other-service",
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), readTokenReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	expectedResponse := map[string]interface{}{
+		"access_token": "clientaccess456",
+		"expires_in":   300,
+		"scope":        "openid profile",
+		"token_type":   "Bearer",
+	}
+
+	if !reflect.DeepEqual(resp.Data, expectedResponse) {
+		t.Fatalf("Expected: %#v\nActual: %#v", expectedResponse, resp.Data)
+	}
+}
+
+func TestBackend_ReadClientTokenFails(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := &keycloak.MockService{}
+
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "somerealm").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+
+	requestedClientId := "myclient"
+	idOfRequestedClient := "123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "somerealm", keycloak.GetClientsParams{
+		ClientID: &requestedClientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfRequestedClient,
+		},
+	}, nil)
+	secretValue := "mysecret123"
+	gocloakClientMock.On("GetClientSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	gocloakClientMock.On("GetToken", mock.Anything, "somerealm", mock.Anything).Return(nil, errors.New("401 unauthorized_client"))
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	})
+
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	readTokenReq := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "realms/somerealm/clients/" + requestedClientId + "/token",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(context.Background(), readTokenReq)
+	if err == nil || (resp == nil || !resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+}
@@ -2,45 +2,106 @@ package keycloak
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"slices"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/pluginidentityutil"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
 const (
-	storageKey         = "config/connection"
-	storagePerRealmKey = "config/realms/%s/connection"
+	defaultConnectionName = "default"
+
+	storageKey              = "config/connections/" + defaultConnectionName
+	storageNamedKey         = "config/connections/%s"
+	storagePerRealmKey      = "config/realms/%s/connection"
+	legacyDefaultStorageKey = "config/connection"
 )
 
+func connectionFields() map[string]*framework.FieldSchema {
+	fields := map[string]*framework.FieldSchema{
+		"server_url": {
+			Type:        framework.TypeString,
+			Description: "Base Keycloak Url http://auth.example.org",
+		},
+		"admin_url": {
+			Type:        framework.TypeString,
+			Description: "Keycloak Url for logins and admin calls, e.g. an internal hostname. Defaults to server_url, which remains the Url of the issuer",
+		},
+		"failover_urls": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "Keycloak Urls that are tried in order if the admin_url, or server_url, is unavailable",
+		},
+		"realm": {
+			Type:        framework.TypeString,
+			Description: "Name of the realm where the clients are stored",
+		},
+		"client_id": {
+			Type:        framework.TypeString,
+			Description: "Client to be used to access keycloak",
+		},
+		"auth_method": {
+			Type:          framework.TypeString,
+			Description:   "How vault logs in with the client: client_secret, client_jwt, which signs a client assertion with private_key, workload_identity, which uses a plugin identity token as client assertion, or password, which logs in a user with admin-cli",
+			AllowedValues: []interface{}{authMethodClientSecret, authMethodClientJWT, authMethodWorkloadIdentity, authMethodPassword},
+		},
+		"client_secret": {
+			Type:        framework.TypeString,
+			Description: `The secret that is used to get an access token`,
+		},
+		"private_key": {
+			Type:        framework.TypeString,
+			Description: "PEM encoded RSA or ECDSA key that signs client assertions for auth_method client_jwt. Generated if not given",
+		},
+		"username": {
+			Type:        framework.TypeString,
+			Description: "User that vault logs in with for auth_method password",
+		},
+		"password": {
+			Type:        framework.TypeString,
+			Description: "Password of the user for auth_method password",
+		},
+		"login_realm": {
+			Type:        framework.TypeString,
+			Description: "Realm of the user for auth_method password, e.g. master. Defaults to realm",
+		},
+		"ignore_connectivity_check": {
+			Type:        framework.TypeBool,
+			Description: `Ignore connectivity check`,
+		},
+		"rotation_period": {
+			Type:        framework.TypeDurationSecond,
+			Description: "Period after which the client secret is rotated automatically. Mutually exclusive with rotation_schedule",
+		},
+		"rotation_schedule": {
+			Type:        framework.TypeString,
+			Description: "CRON-style schedule on which the client secret is rotated automatically. Mutually exclusive with rotation_period",
+		},
+	}
+	pluginidentityutil.AddPluginIdentityTokenFields(fields)
+	for name, field := range transportFields() {
+		fields[name] = field
+	}
+	for name, field := range accessFields() {
+		fields[name] = field
+	}
+	return fields
+}
+
 func pathConfigConnection(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "config/connection",
-		Fields: map[string]*framework.FieldSchema{
-			"server_url": {
-				Type:        framework.TypeString,
-				Description: "Base Keycloak Url http://auth.example.org",
-			},
-			"realm": {
-				Type:        framework.TypeString,
-				Description: "Name of the realm where the clients are stored",
-			},
-			"client_id": {
-				Type:        framework.TypeString,
-				Description: "Client to be used to access keycloak",
-			},
-			"client_secret": {
-				Type:        framework.TypeString,
-				Description: `The secret that is used to get an access token`,
-			},
-			"ignore_connectivity_check": {
-				Type:        framework.TypeBool,
-				Description: `Ignore connectivity check`,
-			},
-		},
+		Fields:  connectionFields(),
 
+		ExistenceCheck: b.connectionExistenceCheck(func(*framework.FieldData) string { return storageKey }),
 		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathConnectionUpdate,
 			logical.UpdateOperation: b.pathConnectionUpdate,
+			logical.PatchOperation:  b.pathConnectionUpdate,
 			logical.ReadOperation:   b.pathConnectionRead,
 			logical.DeleteOperation: b.pathConnectionDelete,
 		},
@@ -49,32 +110,15 @@ func pathConfigConnection(b *backend) *framework.Path {
 func pathConfigConnectionOfRealm(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "config/realms/" + framework.GenericNameRegex("realm") + "/connection",
-		Fields: map[string]*framework.FieldSchema{
-
-			"server_url": {
-				Type:        framework.TypeString,
-				Description: "Base Keycloak Url http://auth.example.org",
-			},
-			"realm": {
-				Type:        framework.TypeString,
-				Description: "Name of the realm where the clients are stored",
-			},
-			"client_id": {
-				Type:        framework.TypeString,
-				Description: "Client to be used to access keycloak",
-			},
-			"client_secret": {
-				Type:        framework.TypeString,
-				Description: `The secret that is used to get an access token`,
-			},
-			"ignore_connectivity_check": {
-				Type:        framework.TypeBool,
-				Description: `Ignore connectivity check`,
-			},
-		},
+		Fields:  connectionFields(),
 
+		ExistenceCheck: b.connectionExistenceCheck(func(data *framework.FieldData) string {
+			return realmSpecificStorageKey(data.Get("realm").(string))
+		}),
 		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathConnectionUpdateOfRealm,
 			logical.UpdateOperation: b.pathConnectionUpdateOfRealm,
+			logical.PatchOperation:  b.pathConnectionUpdateOfRealm,
 			logical.DeleteOperation: b.pathConnectionDeleteForRealm,
 			logical.ReadOperation:   b.pathConnectionReadForRealm,
 		},
@@ -82,97 +126,252 @@ func pathConfigConnectionOfRealm(b *backend) *framework.Path {
 }
 
 func (b *backend) pathConnectionUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	server_url := data.Get("server_url").(string)
-	if server_url == "" {
-		return logical.ErrorResponse("missing server_url"), nil
-	}
+	return b.updateConnection(ctx, req, data, storageKey)
+}
+func (b *backend) pathConnectionUpdateOfRealm(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.updateConnection(ctx, req, data, realmSpecificStorageKey(data.Get("realm").(string)))
+}
 
-	realm := data.Get("realm").(string)
-	if realm == "" {
-		return logical.ErrorResponse("missing realm"), nil
+// connectionExistenceCheck decides between creating and updating the
+// connection stored at the key of the request.
+func (b *backend) connectionExistenceCheck(keyOf func(*framework.FieldData) string) framework.ExistenceFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
+		config, err := readStoredConfig(ctx, req.Storage, keyOf(data))
+		if err != nil {
+			return false, err
+		}
+		return config.ServerUrl != "", nil
 	}
+}
+
+// updateConnection merges the fields of the request into the connection stored
+// at key. Keycloak is only accessed if the credentials of the connection change.
+func (b *backend) updateConnection(ctx context.Context, req *logical.Request, data *framework.FieldData, key string) (*logical.Response, error) {
+	// a concurrent rotation must not be overwritten with the previous secret
+	b.rotateRootMutex.Lock()
+	defer b.rotateRootMutex.Unlock()
 
-	clientId := data.Get("client_id").(string)
-	if clientId == "" {
-		return logical.ErrorResponse("missing client_id"), nil
+	existing, err := readStoredConfig(ctx, req.Storage, key)
+	if err != nil {
+		return nil, err
 	}
-	clientSecret := data.Get("client_secret").(string)
-	if clientSecret == "" {
-		return logical.ErrorResponse("missing client_secret"), nil
+	exists := existing.ServerUrl != ""
+	if req.Operation == logical.PatchOperation && !exists {
+		return logical.ErrorResponse("connection does not exist"), nil
 	}
 
-	ignore_connectivity_check := data.Get("ignore_connectivity_check").(bool)
+	config := existing
+	if server_url, ok := data.GetOk("server_url"); ok {
+		config.ServerUrl = server_url.(string)
+	}
+	if adminUrl, ok := data.GetOk("admin_url"); ok {
+		config.AdminUrl = adminUrl.(string)
+	}
+	if failoverUrls, ok := data.GetOk("failover_urls"); ok {
+		config.FailoverUrls = failoverUrls.([]string)
+	}
+	if realm, ok := data.GetOk("realm"); ok {
+		config.Realm = realm.(string)
+	}
+	if clientId, ok := data.GetOk("client_id"); ok {
+		config.ClientId = clientId.(string)
+	}
+	if authMethod, ok := data.GetOk("auth_method"); ok {
+		config.AuthMethod = authMethod.(string)
+	}
+	if clientSecret, ok := data.GetOk("client_secret"); ok {
+		config.ClientSecret = clientSecret.(string)
+	}
+	if privateKey, ok := data.GetOk("private_key"); ok {
+		config.PrivateKey = privateKey.(string)
+	}
+	if username, ok := data.GetOk("username"); ok {
+		config.Username = username.(string)
+	}
+	if password, ok := data.GetOk("password"); ok {
+		config.Password = password.(string)
+	}
+	if loginRealm, ok := data.GetOk("login_realm"); ok {
+		config.LoginRealm = loginRealm.(string)
+	}
+	config.parseTransportFields(data)
+	config.parseAccessFields(data)
+	if err := config.ParsePluginIdentityTokenFields(data); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if rotationPeriod, ok := data.GetOk("rotation_period"); ok {
+		config.RotationPeriod = time.Duration(rotationPeriod.(int)) * time.Second
+	}
+	if rotationSchedule, ok := data.GetOk("rotation_schedule"); ok {
+		config.RotationSchedule = rotationSchedule.(string)
+	}
 
-	config := ConnectionConfig{
-		ServerUrl:    server_url,
-		Realm:        realm,
-		ClientId:     clientId,
-		ClientSecret: clientSecret,
+	if config.ServerUrl == "" {
+		return logical.ErrorResponse("missing server_url"), nil
+	}
+	if config.AdminUrl != "" {
+		if _, err := url.ParseRequestURI(config.AdminUrl); err != nil {
+			return logical.ErrorResponse("invalid admin_url"), nil
+		}
+	}
+	for _, failoverUrl := range config.FailoverUrls {
+		if _, err := url.ParseRequestURI(failoverUrl); err != nil {
+			return logical.ErrorResponse("invalid failover_urls"), nil
+		}
+	}
+	if config.Realm == "" {
+		return logical.ErrorResponse("missing realm"), nil
+	}
+	if err := config.prepareCredentials(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := config.validateRotation(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := config.validateTransport(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := config.validateAccess(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	if !ignore_connectivity_check {
+	// the period or schedule starts over with a secret written by an operator
+	// or with the rotation being enabled, so that neither rotates right away
+	now := time.Now().UTC()
+	secretChanged := config.ClientSecret != existing.ClientSecret
+	if secretChanged {
+		config.LastRotated = time.Time{}
+	}
+	if config.rotationEnabled() && (secretChanged || !existing.rotationEnabled()) {
+		config.RotationStart = now
+	}
+	config.LastUpdated = now
 
-		if _, _, err := b.getClientAndAccessToken(ctx, config); err != nil {
+	ignore_connectivity_check := data.Get("ignore_connectivity_check").(bool)
+	credentialsChanged := !exists || config.key() != existing.key()
+	transportChanged := exists && !config.sameTransport(existing.TransportConfig)
+	failoverChanged := exists && !slices.Equal(config.FailoverUrls, existing.FailoverUrls)
+
+	if !ignore_connectivity_check && (credentialsChanged || transportChanged || failoverChanged) {
+		// the cached token would hide whether keycloak is reachable with the new settings
+		if transportChanged || failoverChanged {
+			b.forgetAccessToken(config)
+		}
+		_, _, err := b.getClientAndAccessToken(ctx, config)
+		if err == nil {
+			err = b.checkFailoverUrls(ctx, config)
+		}
+		if err != nil {
 			b.logger.Warn("failed to access keycloak", "error", err)
 			return logical.ErrorResponse("failed to access keycloak"), err
 		}
 	}
 
-	if err := writeConfig(ctx, req.Storage, config); err != nil {
+	if err := writeConfigForKey(ctx, req.Storage, config, key); err != nil {
 		return nil, err
 	}
 
 	return nil, nil
 }
-func (b *backend) pathConnectionUpdateOfRealm(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 
-	server_url := data.Get("server_url").(string)
-	if server_url == "" {
-		return logical.ErrorResponse("missing server_url"), nil
+// prepareCredentials drops the credentials that the auth method of the
+// connection does not use and generates a private key if it needs one.
+func (c *ConnectionConfig) prepareCredentials() error {
+	if c.authMethod() != authMethodWorkloadIdentity {
+		c.PluginIdentityTokenParams = pluginidentityutil.PluginIdentityTokenParams{}
 	}
-
-	realm := data.Get("realm").(string)
-	if realm == "" {
-		return logical.ErrorResponse("missing realm"), nil
+	if c.authMethod() != authMethodPassword {
+		c.Username = ""
+		c.Password = ""
+		c.LoginRealm = ""
 	}
 
-	clientId := data.Get("client_id").(string)
-	if clientId == "" {
-		return logical.ErrorResponse("missing client_id"), nil
-	}
-	clientSecret := data.Get("client_secret").(string)
-	if clientSecret == "" {
-		return logical.ErrorResponse("missing client_secret"), nil
+	switch c.authMethod() {
+	case authMethodClientSecret:
+		c.PrivateKey = ""
+		if c.ClientSecret == "" {
+			return errors.New("missing client_secret")
+		}
+	case authMethodPassword:
+		c.ClientSecret = ""
+		c.PrivateKey = ""
+		if c.ClientId == "" {
+			c.ClientId = adminClientID
+		}
+		if c.ClientId != adminClientID {
+			return fmt.Errorf("auth_method %s logs in with client_id %s", authMethodPassword, adminClientID)
+		}
+		if c.Username == "" {
+			return errors.New("missing username")
+		}
+		if c.Password == "" {
+			return errors.New("missing password")
+		}
+	case authMethodWorkloadIdentity:
+		c.ClientSecret = ""
+		c.PrivateKey = ""
+		if c.IdentityTokenAudience == "" {
+			return errors.New("missing identity_token_audience")
+		}
+	case authMethodClientJWT:
+		c.ClientSecret = ""
+		if c.PrivateKey == "" {
+			privateKey, err := generatePrivateKey()
+			if err != nil {
+				return fmt.Errorf("failed to generate private_key: %w", err)
+			}
+			c.PrivateKey = privateKey
+		}
+		if _, _, err := parsePrivateKey(c.PrivateKey); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported auth_method %s", c.AuthMethod)
 	}
 
-	ignore_connectivity_check := data.Get("ignore_connectivity_check").(bool)
-
-	config := ConnectionConfig{
-		ServerUrl:    server_url,
-		Realm:        realm,
-		ClientId:     clientId,
-		ClientSecret: clientSecret,
+	if c.ClientId == "" {
+		return errors.New("missing client_id")
 	}
+	return nil
+}
 
-	if !ignore_connectivity_check {
+// adminURL returns the Url for logins and admin calls.
+func (c ConnectionConfig) adminURL() string {
+	if c.AdminUrl != "" {
+		return c.AdminUrl
+	}
+	return c.ServerUrl
+}
 
-		if _, _, err := b.getClientAndAccessToken(ctx, config); err != nil {
-			b.logger.Info("failed to access keycloak", "error", err)
-			return logical.ErrorResponse("failed to access keycloak"), err
-		}
+// loginRealm returns the realm in which vault logs in.
+func (c ConnectionConfig) loginRealm() string {
+	if c.authMethod() == authMethodPassword && c.LoginRealm != "" {
+		return c.LoginRealm
 	}
+	return c.Realm
+}
 
-	if err := writeConfigForKey(ctx, req.Storage, config, realmSpecificStorageKey(realm)); err != nil {
-		return nil, err
+// checkNotOwnClient reports an error if clientId of realm is the connection's
+// own client, whose secret must not be regenerated behind vault's back.
+func (c ConnectionConfig) checkNotOwnClient(realm string, clientId string) error {
+	if c.isOwnClient(realm, clientId) {
+		return fmt.Errorf("%w: client %s is used by the connection, its secret is managed with config/rotate-root", logical.ErrPermissionDenied, clientId)
 	}
+	return nil
+}
 
-	return nil, nil
+// isOwnClient reports whether clientId of realm is the client that the
+// connection logs in with.
+func (c ConnectionConfig) isOwnClient(realm string, clientId string) bool {
+	return clientId == c.ClientId && (realm == c.Realm || realm == c.loginRealm())
 }
 
 func realmSpecificStorageKey(realm string) string {
 	return fmt.Sprintf(storagePerRealmKey, realm)
 }
 func (b *backend) pathConnectionDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.rotateRootMutex.Lock()
+	defer b.rotateRootMutex.Unlock()
 
 	err := deleteConfig(ctx, req.Storage)
 	if err != nil {
@@ -186,6 +385,9 @@ func (b *backend) pathConnectionDeleteForRealm(ctx context.Context, req *logical
 		return logical.ErrorResponse("missing realm"), nil
 	}
 
+	b.rotateRootMutex.Lock()
+	defer b.rotateRootMutex.Unlock()
+
 	err := deleteConfigForKey(ctx, req.Storage, fmt.Sprintf(storagePerRealmKey, realm))
 	if err != nil {
 		return nil, err
@@ -198,15 +400,7 @@ func (b *backend) pathConnectionRead(ctx context.Context, req *logical.Request,
 		return nil, err
 	}
 
-	response := &logical.Response{
-		Data: map[string]interface{}{
-			"client_id":     config.ClientId,
-			"client_secret": config.ClientSecret,
-			"server_url":    config.ServerUrl,
-			"realm":         config.Realm,
-		},
-	}
-	return response, nil
+	return b.connectionResponse(ctx, req.Storage, config)
 
 }
 func (b *backend) pathConnectionReadForRealm(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
@@ -219,22 +413,99 @@ func (b *backend) pathConnectionReadForRealm(ctx context.Context, req *logical.R
 		return nil, err
 	}
 
+	return b.connectionResponse(ctx, req.Storage, config)
+
+}
+
+// connectionResponse describes config without revealing its client secret.
+func (b *backend) connectionResponse(ctx context.Context, storage logical.Storage, config ConnectionConfig) (*logical.Response, error) {
 	response := &logical.Response{
 		Data: map[string]interface{}{
-			"client_id":     config.ClientId,
-			"client_secret": config.ClientSecret,
-			"server_url":    config.ServerUrl,
-			"realm":         config.Realm,
+			"client_id":   config.ClientId,
+			"server_url":  config.ServerUrl,
+			"realm":       config.Realm,
+			"auth_method": config.authMethod(),
 		},
 	}
-	return response, nil
+	if config.AdminUrl != "" {
+		response.Data["admin_url"] = config.AdminUrl
+	}
+	if len(config.FailoverUrls) > 0 {
+		response.Data["failover_urls"] = config.FailoverUrls
+	}
+	if config.authMethod() == authMethodClientJWT {
+		jwk, err := config.publicKey()
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := config.publicKeyPEM()
+		if err != nil {
+			return nil, err
+		}
+		response.Data["key_id"] = jwk.KeyID
+		response.Data["public_key"] = publicKey
+	}
+	if config.authMethod() == authMethodWorkloadIdentity {
+		config.PopulatePluginIdentityTokenData(response.Data)
+	}
+	if config.authMethod() == authMethodPassword {
+		response.Data["username"] = config.Username
+		response.Data["login_realm"] = config.loginRealm()
+	}
+	config.addTransportData(response.Data)
+	config.addAccessData(response.Data)
+	if err := b.addConnectionMetadata(ctx, storage, config, response.Data); err != nil {
+		return nil, err
+	}
 
+	if config.rotationEnabled() {
+		response.Data["rotation_period"] = int64(config.RotationPeriod.Seconds())
+		response.Data["rotation_schedule"] = config.RotationSchedule
+		if nextRotation, err := config.nextRotation(); err == nil {
+			response.Data["next_rotation"] = nextRotation
+		}
+	}
+	if !config.LastRotated.IsZero() {
+		response.Data["last_rotated"] = config.LastRotated
+	}
+	return response, nil
 }
 
 func readConfig(ctx context.Context, storage logical.Storage) (ConnectionConfig, error) {
+	entry, err := storage.Get(ctx, storageKey)
+	if err != nil {
+		return ConnectionConfig{}, err
+	}
+	// the default connection may not have been migrated yet, e.g. on a standby
+	if entry == nil {
+		return readConfigForKey(ctx, storage, legacyDefaultStorageKey)
+	}
 	return readConfigForKey(ctx, storage, storageKey)
 }
 
+// readConfigForRealm reads the connection configured for realm and falls back
+// to the default connection if there is none.
+func readConfigForRealm(ctx context.Context, storage logical.Storage, realm string) (ConnectionConfig, error) {
+	config, err := readConfigForKey(ctx, storage, realmSpecificStorageKey(realm))
+	if err != nil {
+		return ConnectionConfig{}, err
+	}
+	// if config is empty, try to read the default config
+	if config.ServerUrl == "" {
+		return readConfig(ctx, storage)
+	}
+	return config, nil
+}
+
+// readStoredConfig reads the connection stored at key, considering the legacy
+// location of the default connection.
+func readStoredConfig(ctx context.Context, storage logical.Storage, key string) (ConnectionConfig, error) {
+	if key == storageKey {
+		return readConfig(ctx, storage)
+	}
+	return readConfigForKey(ctx, storage, key)
+}
+
 func readConfigForKey(ctx context.Context, storage logical.Storage, storageKey string) (ConnectionConfig, error) {
 	entry, err := storage.Get(ctx, storageKey)
 	if err != nil {
@@ -266,7 +537,9 @@ func writeConfigForKey(ctx context.Context, storage logical.Storage, config Conn
 }
 
 func deleteConfig(ctx context.Context, storage logical.Storage) error {
-
+	if err := deleteConfigForKey(ctx, storage, legacyDefaultStorageKey); err != nil {
+		return err
+	}
 	return deleteConfigForKey(ctx, storage, storageKey)
 }
 func deleteConfigForKey(ctx context.Context, storage logical.Storage, storageKey string) error {
@@ -279,8 +552,64 @@ func deleteConfigForKey(ctx context.Context, storage logical.Storage, storageKey
 
 // ConnectionConfig contains the information required to make a connection to a RabbitMQ node
 type ConnectionConfig struct {
-	ServerUrl    string `json:"server_url"`
-	Realm        string `json:"realm"`
-	ClientId     string `json:"client_id"`
-	ClientSecret string `json:"client_secret"`
+	ServerUrl    string   `json:"server_url"`
+	AdminUrl     string   `json:"admin_url"`
+	FailoverUrls []string `json:"failover_urls"`
+	Realm        string   `json:"realm"`
+	ClientId     string   `json:"client_id"`
+	AuthMethod   string   `json:"auth_method"`
+	ClientSecret string   `json:"client_secret"`
+	PrivateKey   string   `json:"private_key"`
+	Username     string   `json:"username"`
+	Password     string   `json:"password"`
+	LoginRealm   string   `json:"login_realm"`
+
+	pluginidentityutil.PluginIdentityTokenParams
+	TransportConfig
+	AccessConfig
+
+	RotationPeriod   time.Duration `json:"rotation_period"`
+	RotationSchedule string        `json:"rotation_schedule"`
+	LastRotated      time.Time     `json:"last_rotated"`
+	// RotationStart is when the secret was written or the rotation enabled.
+	RotationStart time.Time `json:"rotation_start"`
+
+	LastUpdated time.Time `json:"last_updated"`
+}
+
+// connectionKey identifies the credentials of a [ConnectionConfig], e.g. for
+// caching access tokens. Unlike the config itself, it does not change with
+// bookkeeping data like the time of the last rotation.
+type connectionKey struct {
+	ServerUrl    string
+	AdminUrl     string
+	Realm        string
+	ClientId     string
+	AuthMethod   string
+	ClientSecret string
+	PrivateKey   string
+	Username     string
+	Password     string
+	LoginRealm   string
+
+	IdentityTokenAudience string
+	IdentityTokenTTL      time.Duration
+}
+
+func (c ConnectionConfig) key() connectionKey {
+	return connectionKey{
+		ServerUrl:    c.ServerUrl,
+		AdminUrl:     c.AdminUrl,
+		Realm:        c.Realm,
+		ClientId:     c.ClientId,
+		AuthMethod:   c.authMethod(),
+		ClientSecret: c.ClientSecret,
+		PrivateKey:   c.PrivateKey,
+		Username:     c.Username,
+		Password:     c.Password,
+		LoginRealm:   c.LoginRealm,
+
+		IdentityTokenAudience: c.IdentityTokenAudience,
+		IdentityTokenTTL:      c.IdentityTokenTTL,
+	}
 }
@@ -0,0 +1,110 @@
+package keycloak
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// jwksPaths are readable without a token, so that keycloak can fetch the
+// public keys of client_jwt connections from them.
+var jwksPaths = []string{
+	"config/connection/jwks",
+	"config/realms/+/connection/jwks",
+	"config/connections/+/jwks",
+}
+
+func pathConfigConnectionJwks(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/connection/jwks",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathConnectionJwksRead,
+		},
+	}
+}
+
+func pathConfigConnectionJwksOfRealm(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/realms/" + framework.GenericNameRegex("realm") + "/connection/jwks",
+		Fields: map[string]*framework.FieldSchema{
+			"realm": {
+				Type:        framework.TypeString,
+				Description: "Name of the realm.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathConnectionJwksReadForRealm,
+		},
+	}
+}
+
+func pathConfigNamedConnectionJwks(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/connections/" + framework.GenericNameRegex("name") + "/jwks",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the connection.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathNamedConnectionJwksRead,
+		},
+	}
+}
+
+func (b *backend) pathConnectionJwksRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return jwksResponse(config)
+}
+
+func (b *backend) pathConnectionJwksReadForRealm(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := readConfigForKey(ctx, req.Storage, realmSpecificStorageKey(data.Get("realm").(string)))
+	if err != nil {
+		return nil, err
+	}
+	return jwksResponse(config)
+}
+
+func (b *backend) pathNamedConnectionJwksRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := readNamedConfig(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	return jwksResponse(config)
+}
+
+// jwksResponse returns the public key of config as raw JSON Web Key Set, which
+// keycloak accepts as JWKS URL of a client.
+func jwksResponse(config ConnectionConfig) (*logical.Response, error) {
+	if config.authMethod() != authMethodClientJWT {
+		return logical.ErrorResponse("connection does not use auth_method %s", authMethodClientJWT), nil
+	}
+
+	jwk, err := config.publicKey()
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:  http.StatusOK,
+			logical.HTTPContentType: "application/json",
+			logical.HTTPRawBody:     body,
+		},
+	}, nil
+}
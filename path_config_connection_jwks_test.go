@@ -0,0 +1,258 @@
+package keycloak
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// validClientAssertion matches client assertions of clientId for realm of
+// http://auth.example.com that are signed by the key with the given id.
+func validClientAssertion(t *testing.T, clientId string, realm string, kid *string) interface{} {
+	t.Helper()
+	return mock.MatchedBy(func(assertion string) bool {
+		token, err := jwt.ParseSigned(assertion, []jose.SignatureAlgorithm{jose.RS256, jose.ES256})
+		if err != nil || len(token.Headers) != 1 || token.Headers[0].KeyID != *kid {
+			return false
+		}
+		var claims jwt.Claims
+		if err := token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+			return false
+		}
+		return claims.Issuer == clientId && claims.Subject == clientId &&
+			claims.Audience.Contains("http://auth.example.com/realms/"+realm) &&
+			claims.Audience.Contains("http://auth.example.com/realms/"+realm+"/protocol/openid-connect/token") &&
+			claims.ID != "" && claims.Expiry != nil
+	})
+}
+
+func TestBackend_ConfigConnectionWithClientJWT(t *testing.T) {
+	ctx := context.Background()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(ctx, config))
+
+	var kid string
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClientAssertion", mock.Anything, "vault", validClientAssertion(t, "vault", "master", &kid), "master").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	// the key is generated before the connectivity check, so skip it to learn the key id first
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url":                "http://auth.example.com",
+			"realm":                     "master",
+			"client_id":                 "vault",
+			"auth_method":               "client_jwt",
+			"ignore_connectivity_check": true,
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "client_jwt", resp.Data["auth_method"])
+	require.NotContains(t, resp.Data, "private_key")
+	require.NotContains(t, resp.Data, "client_secret_fingerprint")
+	require.Contains(t, resp.Data["public_key"], "-----BEGIN PUBLIC KEY-----")
+	kid = resp.Data["key_id"].(string)
+	require.NotEmpty(t, kid)
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/connection/jwks",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "application/json", resp.Data[logical.HTTPContentType])
+	var jwks jose.JSONWebKeySet
+	require.NoError(t, json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &jwks))
+	require.Len(t, jwks.Key(kid), 1)
+	require.Equal(t, "RS256", jwks.Keys[0].Algorithm)
+	require.True(t, jwks.Keys[0].IsPublic())
+
+	stored, err := readConfig(ctx, config.StorageView)
+	require.NoError(t, err)
+	_, token, err := b.getClientAndAccessToken(ctx, stored)
+	require.NoError(t, err)
+	require.Equal(t, "access123", token.AccessToken)
+	gocloakClientMock.AssertExpectations(t)
+	gocloakClientMock.AssertNotCalled(t, "LoginClient", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBackend_ConfigConnectionWithGivenPrivateKey(t *testing.T) {
+	ctx := context.Background()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(ctx, config))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	privateKey := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	kid, err := keyID(key.Public())
+	require.NoError(t, err)
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClientAssertion", mock.Anything, "vault1", validClientAssertion(t, "vault1", "realm1", &kid), "realm1").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/realms/realm1/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url":  "http://auth.example.com",
+			"client_id":   "vault1",
+			"auth_method": "client_jwt",
+			"private_key": privateKey,
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	gocloakClientMock.AssertExpectations(t)
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/realms/realm1/connection/jwks",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	var jwks jose.JSONWebKeySet
+	require.NoError(t, json.Unmarshal(resp.Data[logical.HTTPRawBody].([]byte), &jwks))
+	require.Len(t, jwks.Key(kid), 1)
+	require.Equal(t, "ES256", jwks.Keys[0].Algorithm)
+}
+
+func TestBackend_ConfigConnectionWithClientJWTRejectsInvalidConfig(t *testing.T) {
+	ctx := context.Background()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(ctx, config))
+	b.KeycloakServiceFactory = failingMockedGocloakFactory(t)
+
+	for name, data := range map[string]map[string]interface{}{
+		"invalid private key": {
+			"private_key": "not a key",
+		},
+		"rotation": {
+			"rotation_period": "24h",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data["server_url"] = "http://auth.example.com"
+			data["realm"] = "master"
+			data["client_id"] = "vault"
+			data["auth_method"] = "client_jwt"
+			data["ignore_connectivity_check"] = true
+
+			resp, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      "config/connections/staging",
+				Storage:   config.StorageView,
+				Data:      data,
+			})
+			require.NoError(t, err)
+			require.True(t, resp.IsError())
+		})
+	}
+}
+
+func TestBackend_ReadJwksOfClientSecretConnection(t *testing.T) {
+	ctx := context.Background()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(ctx, config))
+
+	require.NoError(t, writeConfigForKey(ctx, config.StorageView, ConnectionConfig{
+		ServerUrl:    "http://auth.example.com",
+		Realm:        "master",
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+	}, "config/connections/staging"))
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/connections/staging/jwks",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+	require.Contains(t, b.SpecialPaths().Unauthenticated, "config/connections/+/jwks")
+}
+
+func TestBackend_ClientJWTWithAdminUrl(t *testing.T) {
+	ctx := context.Background()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(ctx, config))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	kid, err := keyID(key.Public())
+	require.NoError(t, err)
+
+	// the assertion is posted to admin_url but addressed to server_url
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClientAssertion", mock.Anything, "vault", validClientAssertion(t, "vault", "master", &kid), "master").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	b.KeycloakServiceFactory = func(serverUrl string, _ keycloak.ServiceOptions) (keycloak.Service, error) {
+		require.Equal(t, "http://keycloak.internal:8080", serverUrl)
+		return gocloakClientMock, nil
+	}
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url":  "http://auth.example.com",
+			"admin_url":   "http://keycloak.internal:8080",
+			"realm":       "master",
+			"client_id":   "vault",
+			"auth_method": "client_jwt",
+			"private_key": string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})),
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	gocloakClientMock.AssertExpectations(t)
+}
@@ -3,12 +3,20 @@ package keycloak
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+	"testing/synctest"
+	"time"
 
 	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	testutil "github.com/Serviceware/vault-plugin-secrets-keycloak/util/test"
+	"github.com/hashicorp/vault/sdk/helper/pluginutil"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type DummyMockClients struct {
@@ -107,6 +115,10 @@ func TestBackend_UpdateConfigConnection(t *testing.T) {
 		ClientSecret: "secret123",
 	}
 
+	if actualConfig.LastUpdated.IsZero() {
+		t.Fatal("expected last_updated to be set")
+	}
+	expectedConfig.LastUpdated = actualConfig.LastUpdated
 	if !reflect.DeepEqual(actualConfig, expectedConfig) {
 		t.Fatalf("Expected: %#v\nActual: %#v", expectedConfig, actualConfig)
 	}
@@ -205,11 +217,16 @@ func TestBackend_ReadConfigConnection(t *testing.T) {
 		t.Fatal("expected non nil response")
 	}
 
+	fingerprint, err := b.fingerprint(context.Background(), config.StorageView, "secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
 	expectedConfigData := map[string]interface{}{
-		"server_url":    "http://auth.example.com",
-		"realm":         "master",
-		"client_id":     "vault",
-		"client_secret": "secret123",
+		"server_url":                "http://auth.example.com",
+		"realm":                     "master",
+		"client_id":                 "vault",
+		"auth_method":               "client_secret",
+		"client_secret_fingerprint": fingerprint,
 	}
 
 	if !reflect.DeepEqual(resp.Data, expectedConfigData) {
@@ -333,6 +350,10 @@ func TestBackend_UpdateConfigConnectionForRealm(t *testing.T) {
 		ClientSecret: "realm1_secret123",
 	}
 
+	if actualConfig.LastUpdated.IsZero() {
+		t.Fatal("expected last_updated to be set")
+	}
+	expectedConfig.LastUpdated = actualConfig.LastUpdated
 	if !reflect.DeepEqual(actualConfig, expectedConfig) {
 		t.Fatalf("Expected: %#v\nActual: %#v", expectedConfig, actualConfig)
 	}
@@ -476,6 +497,10 @@ func TestBackend_UpdateConfigConnectionForRealmDoNotConflict(t *testing.T) {
 		ClientSecret: "realm1_secret123",
 	}
 
+	if actualConfig1.LastUpdated.IsZero() {
+		t.Fatal("expected last_updated to be set")
+	}
+	expectedConfig1.LastUpdated = actualConfig1.LastUpdated
 	if !reflect.DeepEqual(actualConfig1, expectedConfig1) {
 		t.Fatalf("Expected: %#v\nActual: %#v", expectedConfig1, actualConfig1)
 	}
@@ -492,6 +517,10 @@ func TestBackend_UpdateConfigConnectionForRealmDoNotConflict(t *testing.T) {
 		ClientSecret: "realm2_secret456",
 	}
 
+	if actualConfig2.LastUpdated.IsZero() {
+		t.Fatal("expected last_updated to be set")
+	}
+	expectedConfig2.LastUpdated = actualConfig2.LastUpdated
 	if !reflect.DeepEqual(actualConfig2, expectedConfig2) {
 		t.Fatalf("Expected: %#v\nActual: %#v", expectedConfig2, actualConfig2)
 	}
@@ -591,14 +620,518 @@ func TestBackend_ReadConfigConnectionForRealm(t *testing.T) {
 		t.Fatal("expected non nil response")
 	}
 
+	fingerprint, err := b.fingerprint(context.Background(), config.StorageView, "realm1_secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
 	expectedConfigData := map[string]interface{}{
-		"server_url":    "http://auth1.example.com",
-		"realm":         "realm1",
-		"client_id":     "vault1",
-		"client_secret": "realm1_secret123",
+		"server_url":                "http://auth1.example.com",
+		"realm":                     "realm1",
+		"client_id":                 "vault1",
+		"auth_method":               "client_secret",
+		"client_secret_fingerprint": fingerprint,
 	}
 
 	if !reflect.DeepEqual(resp.Data, expectedConfigData) {
 		t.Fatalf("Expected: %#v\nActual: %#v", expectedConfigData, resp.Data)
 	}
 }
+
+func TestBackend_ConfigConnectionRejectsPeriodAndSchedule(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	b.KeycloakServiceFactory = mockedGocloakFactory(t, "master", "vault", "secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	configData := map[string]interface{}{
+		"server_url":        "http://auth.example.com",
+		"realm":             "master",
+		"client_id":         "vault",
+		"client_secret":     "secret123",
+		"rotation_period":   "24h",
+		"rotation_schedule": "0 * * * *",
+	}
+	configReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data:      configData,
+	}
+	resp, err = b.HandleRequest(context.Background(), configReq)
+	if err != nil {
+		t.Fatalf("Expected no error")
+	}
+	if !resp.IsError() {
+		t.Fatalf("bad: resp: %#v is not an error\nerr:%s", resp, err)
+	}
+}
+
+func TestBackend_ReadConfigConnectionWithRotation(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	b.KeycloakServiceFactory = mockedGocloakFactory(t, "master", "vault", "secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	lastRotated := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	connectionConfig := ConnectionConfig{
+		ServerUrl:      "http://auth.example.com",
+		Realm:          "master",
+		ClientId:       "vault",
+		ClientSecret:   "secret123",
+		RotationPeriod: 24 * time.Hour,
+		LastRotated:    lastRotated,
+	}
+
+	if err = writeConfig(context.Background(), config.StorageView, connectionConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	configReq := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+	}
+
+	resp, err = b.HandleRequest(context.Background(), configReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	fingerprint, err := b.fingerprint(context.Background(), config.StorageView, "secret123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedConfigData := map[string]interface{}{
+		"server_url":                "http://auth.example.com",
+		"realm":                     "master",
+		"client_id":                 "vault",
+		"auth_method":               "client_secret",
+		"client_secret_fingerprint": fingerprint,
+		"rotation_period":           int64(86400),
+		"rotation_schedule":         "",
+		"last_rotated":              lastRotated,
+		"next_rotation":             lastRotated.Add(24 * time.Hour),
+	}
+
+	if !reflect.DeepEqual(resp.Data, expectedConfigData) {
+		t.Fatalf("Expected: %#v\nActual: %#v", expectedConfigData, resp.Data)
+	}
+}
+
+func TestBackend_ReadConfigConnectionWithLoginMetadata(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		config := logical.TestBackendConfig()
+		config.StorageView = &logical.InmemStorage{}
+		b, err := newBackend(config)
+		require.NoError(t, err)
+
+		gocloakClientMock := &keycloak.MockService{}
+		gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+			AccessToken: testutil.JWT(5 * time.Minute),
+		}, nil)
+		b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+		require.NoError(t, b.Setup(t.Context(), config))
+
+		resp, err := b.HandleRequest(t.Context(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config/connection",
+			Storage:   config.StorageView,
+			Data: map[string]interface{}{
+				"server_url":    "http://auth.example.com",
+				"realm":         "master",
+				"client_id":     "vault",
+				"client_secret": "secret123",
+			},
+		})
+		require.NoError(t, err)
+		require.Nil(t, resp)
+
+		resp, err = b.HandleRequest(t.Context(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "config/connection",
+			Storage:   config.StorageView,
+		})
+		require.NoError(t, err)
+
+		require.NotContains(t, resp.Data, "client_secret")
+		require.Equal(t, time.Now().UTC(), resp.Data["last_updated"])
+		require.Equal(t, time.Now().UTC(), resp.Data["last_successful_login"])
+		require.Equal(t, time.Now().Add(5*time.Minute).UTC(), resp.Data["token_expiry"])
+
+		// the fingerprint changes with the secret
+		otherFingerprint, err := b.fingerprint(t.Context(), config.StorageView, "other456")
+		require.NoError(t, err)
+		require.NotEqual(t, otherFingerprint, resp.Data["client_secret_fingerprint"])
+		require.NotContains(t, resp.Data["client_secret_fingerprint"], "secret123")
+	})
+}
+
+func TestBackend_PatchConfigConnection(t *testing.T) {
+	ctx := context.Background()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(ctx, config))
+
+	existsReq := &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+	}
+	_, exists, err := b.HandleExistenceCheck(ctx, existsReq)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	b.KeycloakServiceFactory = mockedGocloakFactory(t, "master", "vault", "secret123")
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url":    "http://auth.example.com",
+			"realm":         "master",
+			"client_id":     "vault",
+			"client_secret": "secret123",
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	_, exists, err = b.HandleExistenceCheck(ctx, existsReq)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	// keycloak is not accessed unless the credentials change
+	b.KeycloakServiceFactory = failingMockedGocloakFactory(t)
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.PatchOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"rotation_period": "24h",
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.PatchOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url": "http://auth2.example.com",
+		},
+	})
+	require.Error(t, err)
+	require.True(t, resp.IsError())
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url":                "http://auth2.example.com",
+			"ignore_connectivity_check": true,
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	actualConfig, err := readConfig(ctx, config.StorageView)
+	require.NoError(t, err)
+	require.Equal(t, "http://auth2.example.com", actualConfig.ServerUrl)
+	require.Equal(t, "master", actualConfig.Realm)
+	require.Equal(t, "vault", actualConfig.ClientId)
+	require.Equal(t, "secret123", actualConfig.ClientSecret)
+	require.Equal(t, 24*time.Hour, actualConfig.RotationPeriod)
+}
+
+func TestBackend_PatchConfigConnectionWhenNotExists(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+	b.KeycloakServiceFactory = failingMockedGocloakFactory(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.PatchOperation,
+		Path:      "config/realms/realm1/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url": "http://auth.example.com",
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	entry, err := config.StorageView.Get(context.Background(), "config/realms/realm1/connection")
+	require.NoError(t, err)
+	require.Nil(t, entry)
+}
+
+// identityTokenSystemView issues plugin identity tokens like vault enterprise.
+type identityTokenSystemView struct {
+	logical.StaticSystemView
+	requests []*pluginutil.IdentityTokenRequest
+}
+
+func (s *identityTokenSystemView) GenerateIdentityToken(_ context.Context, req *pluginutil.IdentityTokenRequest) (*pluginutil.IdentityTokenResponse, error) {
+	s.requests = append(s.requests, req)
+	return &pluginutil.IdentityTokenResponse{
+		Token: pluginutil.IdentityToken(fmt.Sprintf("identity-token-%d", len(s.requests))),
+		TTL:   req.TTL,
+	}, nil
+}
+
+func TestBackend_ConfigConnectionWithWorkloadIdentity(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		ctx := context.Background()
+		systemView := &identityTokenSystemView{}
+		config := logical.TestBackendConfig()
+		config.StorageView = &logical.InmemStorage{}
+		config.System = systemView
+		b, err := newBackend(config)
+		require.NoError(t, err)
+		require.NoError(t, b.Setup(ctx, config))
+
+		gocloakClientMock := &keycloak.MockService{}
+		gocloakClientMock.On("LoginClientAssertion", mock.Anything, "vault", "identity-token-1", "master").Return(&keycloak.JWT{
+			AccessToken: testutil.JWT(time.Minute),
+		}, nil).Once()
+		gocloakClientMock.On("LoginClientAssertion", mock.Anything, "vault", "identity-token-2", "master").Return(&keycloak.JWT{
+			AccessToken: testutil.JWT(time.Minute),
+		}, nil).Once()
+		b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+		resp, err := b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "config/connection",
+			Storage:   config.StorageView,
+			Data: map[string]interface{}{
+				"server_url":              "http://auth.example.com",
+				"realm":                   "master",
+				"client_id":               "vault",
+				"auth_method":             "workload_identity",
+				"identity_token_audience": "http://auth.example.com/realms/master",
+				"identity_token_ttl":      "10m",
+			},
+		})
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+		require.Equal(t, []*pluginutil.IdentityTokenRequest{
+			{Audience: "http://auth.example.com/realms/master", TTL: 10 * time.Minute},
+		}, systemView.requests)
+
+		resp, err = b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "config/connection",
+			Storage:   config.StorageView,
+		})
+		require.NoError(t, err)
+		require.Equal(t, "workload_identity", resp.Data["auth_method"])
+		require.Equal(t, "http://auth.example.com/realms/master", resp.Data["identity_token_audience"])
+		require.Equal(t, int64(600), resp.Data["identity_token_ttl"])
+		require.NotContains(t, resp.Data, "client_secret_fingerprint")
+
+		stored, err := readConfig(ctx, config.StorageView)
+		require.NoError(t, err)
+
+		// the cached access token is used while it is valid
+		_, _, err = b.getClientAndAccessToken(ctx, stored)
+		require.NoError(t, err)
+		require.Len(t, systemView.requests, 1)
+
+		// a fresh identity token is requested once it expired
+		time.Sleep(time.Minute)
+		_, _, err = b.getClientAndAccessToken(ctx, stored)
+		require.NoError(t, err)
+		require.Len(t, systemView.requests, 2)
+		gocloakClientMock.AssertExpectations(t)
+	})
+}
+
+func TestBackend_ConfigConnectionWithWorkloadIdentityRequiresAudience(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+	b.KeycloakServiceFactory = failingMockedGocloakFactory(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url":  "http://auth.example.com",
+			"realm":       "master",
+			"client_id":   "vault",
+			"auth_method": "workload_identity",
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+	require.Equal(t, "missing identity_token_audience", resp.Error().Error())
+}
+
+func TestBackend_ConfigConnectionWithPassword(t *testing.T) {
+	ctx := context.Background()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(ctx, config))
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginAdmin", mock.Anything, "admin", "password123", "master").Return(&keycloak.JWT{
+		AccessToken: testutil.JWT(time.Minute),
+	}, nil).Once()
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/realms/realm1/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url":  "http://auth.example.com",
+			"auth_method": "password",
+			"username":    "admin",
+			"password":    "password123",
+			"login_realm": "master",
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/realms/realm1/connection",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	fingerprint, err := b.fingerprint(ctx, config.StorageView, "password123")
+	require.NoError(t, err)
+	require.Equal(t, "password", resp.Data["auth_method"])
+	require.Equal(t, "admin-cli", resp.Data["client_id"])
+	require.Equal(t, "realm1", resp.Data["realm"])
+	require.Equal(t, "admin", resp.Data["username"])
+	require.Equal(t, "master", resp.Data["login_realm"])
+	require.Equal(t, fingerprint, resp.Data["password_fingerprint"])
+	require.NotContains(t, resp.Data, "password")
+
+	// the access token of the connectivity check is cached
+	stored, err := readConfigForRealm(ctx, config.StorageView, "realm1")
+	require.NoError(t, err)
+	_, _, err = b.getClientAndAccessToken(ctx, stored)
+	require.NoError(t, err)
+	gocloakClientMock.AssertExpectations(t)
+}
+
+func TestBackend_ConfigConnectionWithPasswordRejectsOtherClients(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+	b.KeycloakServiceFactory = failingMockedGocloakFactory(t)
+
+	for name, data := range map[string]map[string]interface{}{
+		"other client": {
+			"client_id": "vault",
+			"username":  "admin",
+			"password":  "password123",
+		},
+		"missing password": {
+			"username": "admin",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data["server_url"] = "http://auth.example.com"
+			data["realm"] = "master"
+			data["auth_method"] = "password"
+
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      "config/connection",
+				Storage:   config.StorageView,
+				Data:      data,
+			})
+			require.NoError(t, err)
+			require.True(t, resp.IsError())
+		})
+	}
+}
+
+func TestBackend_ConfigConnectionWithAdminUrl(t *testing.T) {
+	var adminRequests, publicRequests []string
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminRequests = append(adminRequests, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"access_token":%q,"expires_in":60}`, testutil.JWT(time.Minute))
+	}))
+	t.Cleanup(admin.Close)
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		publicRequests = append(publicRequests, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"issuer":"https://auth.example.com/realms/master"}`))
+	}))
+	t.Cleanup(public.Close)
+
+	ctx := context.Background()
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(ctx, config))
+
+	resp, err := b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"server_url":    public.URL,
+			"admin_url":     admin.URL,
+			"realm":         "master",
+			"client_id":     "vault",
+			"client_secret": "secret123",
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+	require.Equal(t, []string{"/realms/master/protocol/openid-connect/token"}, adminRequests)
+
+	resp, err = b.HandleRequest(ctx, &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/connection",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Equal(t, public.URL, resp.Data["server_url"])
+	require.Equal(t, admin.URL, resp.Data["admin_url"])
+
+	stored, err := readConfig(ctx, config.StorageView)
+	require.NoError(t, err)
+	openidConfig, err := b.getGetWellKnownOpenidConfiguration(ctx, stored, "master")
+	require.NoError(t, err)
+	require.Equal(t, "https://auth.example.com/realms/master", openidConfig.Issuer)
+	require.Equal(t, []string{"/realms/master/.well-known/openid-configuration"}, publicRequests)
+	require.Len(t, adminRequests, 1)
+}
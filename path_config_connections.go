@@ -0,0 +1,207 @@
+package keycloak
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathConfigConnections(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/connections/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathConnectionsList,
+		},
+	}
+}
+
+func pathConfigNamedConnection(b *backend) *framework.Path {
+	fields := connectionFields()
+	fields["name"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Name of the connection.",
+	}
+
+	return &framework.Path{
+		Pattern: "config/connections/" + framework.GenericNameRegex("name"),
+		Fields:  fields,
+
+		ExistenceCheck: b.connectionExistenceCheck(func(data *framework.FieldData) string {
+			return namedStorageKey(data.Get("name").(string))
+		}),
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathNamedConnectionUpdate,
+			logical.UpdateOperation: b.pathNamedConnectionUpdate,
+			logical.PatchOperation:  b.pathNamedConnectionUpdate,
+			logical.ReadOperation:   b.pathNamedConnectionRead,
+			logical.DeleteOperation: b.pathNamedConnectionDelete,
+		},
+	}
+}
+
+func pathConfigNamedConnectionRotateRoot(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/connections/" + framework.GenericNameRegex("name") + "/rotate-root",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the connection that should be rotated.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathNamedConnectionRotateRootUpdate,
+		},
+	}
+}
+
+func (b *backend) pathConnectionsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names, err := listConnectionNames(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(names), nil
+}
+
+func (b *backend) pathNamedConnectionUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.updateConnection(ctx, req, data, namedStorageKey(data.Get("name").(string)))
+}
+
+func (b *backend) pathNamedConnectionRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := readNamedConfig(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if config.ServerUrl == "" {
+		return nil, nil
+	}
+
+	return b.connectionResponse(ctx, req.Storage, config)
+}
+
+func (b *backend) pathNamedConnectionDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	b.rotateRootMutex.Lock()
+	defer b.rotateRootMutex.Unlock()
+
+	if name == defaultConnectionName {
+		return nil, deleteConfig(ctx, req.Storage)
+	}
+	return nil, deleteConfigForKey(ctx, req.Storage, namedStorageKey(name))
+}
+
+func (b *backend) pathNamedConnectionRotateRootUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.rotateRootCredential(ctx, req.Storage, namedStorageKey(data.Get("name").(string))); err != nil {
+		return logical.ErrorResponse("failed to rotate root credential"), err
+	}
+	return nil, nil
+}
+
+// withConnection derives a path that addresses a named connection from a path
+// of the default connection, e.g. connections/:name/realms/:realm/... from
+// realms/:realm/.... Handlers resolve the connection with [readConfigForRequest].
+func withConnection(path *framework.Path) *framework.Path {
+	fields := make(map[string]*framework.FieldSchema, len(path.Fields)+1)
+	for name, field := range path.Fields {
+		fields[name] = field
+	}
+	fields["connection"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Name of the connection.",
+	}
+
+	namedPath := *path
+	namedPath.Pattern = "connections/" + framework.GenericNameRegex("connection") + "/" + path.Pattern
+	namedPath.Fields = fields
+	return &namedPath
+}
+
+// readConfigForRequest reads the named connection of a path derived by
+// [withConnection] or, for all other paths, the connection configured for realm.
+func readConfigForRequest(ctx context.Context, storage logical.Storage, data *framework.FieldData, realm string) (ConnectionConfig, error) {
+	if _, ok := data.Schema["connection"]; !ok {
+		return readConfigForRealm(ctx, storage, realm)
+	}
+
+	name := data.Get("connection").(string)
+	config, err := readNamedConfig(ctx, storage, name)
+	if err != nil {
+		return ConnectionConfig{}, err
+	}
+	if config.ServerUrl == "" {
+		return ConnectionConfig{}, fmt.Errorf("unknown connection %s", name)
+	}
+	return config, nil
+}
+
+func namedStorageKey(name string) string {
+	return fmt.Sprintf(storageNamedKey, name)
+}
+
+func readNamedConfig(ctx context.Context, storage logical.Storage, name string) (ConnectionConfig, error) {
+	if name == defaultConnectionName {
+		return readConfig(ctx, storage)
+	}
+	return readConfigForKey(ctx, storage, namedStorageKey(name))
+}
+
+func listConnectionNames(ctx context.Context, storage logical.Storage) ([]string, error) {
+	names, err := storage.List(ctx, "config/connections/")
+	if err != nil {
+		return nil, err
+	}
+
+	// the default connection may not have been migrated yet
+	for _, name := range names {
+		if name == defaultConnectionName {
+			return names, nil
+		}
+	}
+	legacy, err := storage.Get(ctx, legacyDefaultStorageKey)
+	if err != nil {
+		return nil, err
+	}
+	if legacy != nil {
+		names = append([]string{defaultConnectionName}, names...)
+	}
+	return names, nil
+}
+
+// migrateDefaultConnection moves the default connection from config/connection,
+// where it was stored before connections were named, to config/connections/default.
+func migrateDefaultConnection(ctx context.Context, storage logical.Storage) error {
+	legacy, err := storage.Get(ctx, legacyDefaultStorageKey)
+	if err != nil || legacy == nil {
+		return err
+	}
+
+	current, err := storage.Get(ctx, storageKey)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		if err := storage.Put(ctx, &logical.StorageEntry{Key: storageKey, Value: legacy.Value}); err != nil {
+			return err
+		}
+	}
+
+	return storage.Delete(ctx, legacyDefaultStorageKey)
+}
+
+func (b *backend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
+	if !b.WriteSafeReplicationState() {
+		return nil
+	}
+
+	if err := migrateDefaultConnection(ctx, req.Storage); err != nil {
+		return fmt.Errorf("failed to migrate the default connection: %w", err)
+	}
+	if err := migrateSealWrap(ctx, req.Storage); err != nil {
+		return fmt.Errorf("failed to seal wrap stored credentials: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package keycloak
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_NamedConnections(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+
+	for path, clientId := range map[string]string{
+		"config/connection":          "vault",
+		"config/connections/staging": "vault-staging",
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data: map[string]interface{}{
+				"server_url":                "http://example.com/auth",
+				"realm":                     "master",
+				"client_id":                 clientId,
+				"client_secret":             "secret123",
+				"ignore_connectivity_check": true,
+			},
+		})
+		require.NoError(t, err)
+		require.Nil(t, resp)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "config/connections/",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"default", "staging"}, resp.Data["keys"])
+
+	// config/connection is an alias of the default connection
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/connections/default",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "vault", resp.Data["client_id"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/connections/staging",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "vault-staging", resp.Data["client_id"])
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "config/connections/staging",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Nil(t, resp)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config/connections/staging",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Nil(t, resp)
+}
+
+func TestBackend_ReadClientSecretOfNamedConnection(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault-staging", "staging123", "somerealm").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	requestedClientId := "myclient"
+	idOfRequestedClient := "123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "somerealm", keycloak.GetClientsParams{
+		ClientID: &requestedClientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfRequestedClient,
+		},
+	}, nil)
+	secretValue := "stagingsecret456"
+	gocloakClientMock.On("GetClientSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	gocloakClientMock.On("GetWellKnownOpenidConfiguration", mock.Anything, "somerealm").Return(&keycloak.WellKnownOpenidConfiguration{
+		Issuer: "THIS_IS_THE_ISSUER",
+	}, nil)
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	require.NoError(t, b.Setup(context.Background(), config))
+
+	// the same realm is served by the default connection
+	require.NoError(t, writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	}))
+	require.NoError(t, writeConfigForKey(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault-staging",
+		ClientSecret: "staging123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://staging.example.com/auth",
+	}, "config/connections/staging"))
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "connections/staging/realms/somerealm/clients/myclient/secret",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"client_secret": "stagingsecret456",
+		"client_id":     "myclient",
+		"issuer":        "THIS_IS_THE_ISSUER",
+	}, resp.Data)
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "connections/unknown/realms/somerealm/clients/myclient/secret",
+		Storage:   config.StorageView,
+	})
+	require.Error(t, err)
+	require.True(t, resp.IsError())
+}
+
+func TestBackend_MigrateDefaultConnection(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+
+	legacyConfig := ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "master",
+		ServerUrl:    "http://example.com/auth",
+	}
+	require.NoError(t, writeConfigForKey(context.Background(), config.StorageView, legacyConfig, "config/connection"))
+
+	// the legacy key is read until the migration ran
+	actualConfig, err := readConfig(context.Background(), config.StorageView)
+	require.NoError(t, err)
+	require.Equal(t, legacyConfig, actualConfig)
+
+	require.NoError(t, b.Initialize(context.Background(), &logical.InitializationRequest{Storage: config.StorageView}))
+
+	entry, err := config.StorageView.Get(context.Background(), "config/connection")
+	require.NoError(t, err)
+	require.Nil(t, entry)
+
+	actualConfig, err = readConfigForKey(context.Background(), config.StorageView, "config/connections/default")
+	require.NoError(t, err)
+	require.Equal(t, legacyConfig, actualConfig)
+}
@@ -0,0 +1,82 @@
+package keycloak
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathConfigRealms(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/realms/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathConfigRealmsList,
+		},
+	}
+}
+
+func (b *backend) pathConfigRealmsList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, "config/realms/")
+	if err != nil {
+		return nil, err
+	}
+
+	realms := make([]string, 0, len(entries))
+	keyInfo := make(map[string]interface{}, len(entries))
+	for _, entry := range entries {
+		realm := strings.TrimSuffix(entry, "/")
+		config, err := readConfigForKey(ctx, req.Storage, realmSpecificStorageKey(realm))
+		if err != nil {
+			return nil, err
+		}
+		if config.ServerUrl == "" {
+			continue
+		}
+
+		info := map[string]interface{}{
+			"server_url": config.ServerUrl,
+			"client_id":  config.ClientId,
+		}
+		if status, ok := b.loginStatusOf(config); ok {
+			info["reachable"] = status.reachable
+			info["last_check"] = status.checkedAt
+		}
+		realms = append(realms, realm)
+		keyInfo[realm] = info
+	}
+
+	return logical.ListResponseWithInfo(realms, keyInfo), nil
+}
+
+// loginStatus is the outcome of the last login with the credentials of a
+// connection. It is only kept in memory.
+type loginStatus struct {
+	checkedAt   time.Time
+	reachable   bool
+	lastSuccess time.Time
+}
+
+func (b *backend) recordLogin(config ConnectionConfig, err error) {
+	b.loginStatusMutex.Lock()
+	defer b.loginStatusMutex.Unlock()
+
+	status := b.loginStatus[config.key()]
+	status.checkedAt = time.Now().UTC()
+	status.reachable = err == nil
+	if status.reachable {
+		status.lastSuccess = status.checkedAt
+	}
+	b.loginStatus[config.key()] = status
+}
+
+func (b *backend) loginStatusOf(config ConnectionConfig) (loginStatus, bool) {
+	b.loginStatusMutex.Lock()
+	defer b.loginStatusMutex.Unlock()
+
+	status, ok := b.loginStatus[config.key()]
+	return status, ok
+}
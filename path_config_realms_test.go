@@ -0,0 +1,61 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackend_ListRealmConnections(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault-a", "secret-a", "realm-a").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault-b", "secret-b", "realm-b").Return(nil, errors.New("401 Unauthorized"))
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	require.NoError(t, b.Setup(context.Background(), config))
+
+	connections := map[string]ConnectionConfig{
+		"realm-a": {ServerUrl: "http://a.example.com/auth", Realm: "realm-a", ClientId: "vault-a", ClientSecret: "secret-a"},
+		"realm-b": {ServerUrl: "http://b.example.com/auth", Realm: "realm-b", ClientId: "vault-b", ClientSecret: "secret-b"},
+		"realm-c": {ServerUrl: "http://c.example.com/auth", Realm: "realm-c", ClientId: "vault-c", ClientSecret: "secret-c"},
+	}
+	for realm, connection := range connections {
+		require.NoError(t, writeConfigForKey(context.Background(), config.StorageView, connection, realmSpecificStorageKey(realm)))
+	}
+
+	_, _, err = b.getClientAndAccessToken(context.Background(), connections["realm-a"])
+	require.NoError(t, err)
+	_, _, err = b.getClientAndAccessToken(context.Background(), connections["realm-b"])
+	require.Error(t, err)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "config/realms/",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"realm-a", "realm-b", "realm-c"}, resp.Data["keys"])
+
+	keyInfo := resp.Data["key_info"].(map[string]interface{})
+	infoA := keyInfo["realm-a"].(map[string]interface{})
+	require.Equal(t, "http://a.example.com/auth", infoA["server_url"])
+	require.Equal(t, "vault-a", infoA["client_id"])
+	require.Equal(t, true, infoA["reachable"])
+	require.NotNil(t, infoA["last_check"])
+	require.Equal(t, false, keyInfo["realm-b"].(map[string]interface{})["reachable"])
+	require.Equal(t, map[string]interface{}{
+		"server_url": "http://c.example.com/auth",
+		"client_id":  "vault-c",
+	}, keyInfo["realm-c"])
+}
@@ -0,0 +1,254 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/backoff"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/sdk/rotation"
+)
+
+const (
+	minRotationRetryDelay = time.Minute
+	maxRotationRetryDelay = time.Hour
+)
+
+func pathConfigRotateRoot(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/rotate-root",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateRootUpdate,
+		},
+	}
+}
+func pathConfigRotateRootOfRealm(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/realms/" + framework.GenericNameRegex("realm") + "/rotate-root",
+		Fields: map[string]*framework.FieldSchema{
+			"realm": {
+				Type:        framework.TypeString,
+				Description: "Name of the realm whose connection should be rotated.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateRootUpdateOfRealm,
+		},
+	}
+}
+
+func (b *backend) pathRotateRootUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.rotateRootCredential(ctx, req.Storage, storageKey); err != nil {
+		return logical.ErrorResponse("failed to rotate root credential"), err
+	}
+	return nil, nil
+}
+func (b *backend) pathRotateRootUpdateOfRealm(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	realm := data.Get("realm").(string)
+	if realm == "" {
+		return logical.ErrorResponse("missing realm"), nil
+	}
+
+	if err := b.rotateRootCredential(ctx, req.Storage, realmSpecificStorageKey(realm)); err != nil {
+		return logical.ErrorResponse("failed to rotate root credential"), err
+	}
+	return nil, nil
+}
+
+// rotateRootCredential regenerates the secret of the client that the connection stored under
+// key uses to access keycloak.
+func (b *backend) rotateRootCredential(ctx context.Context, storage logical.Storage, key string) error {
+	b.rotateRootMutex.Lock()
+	defer b.rotateRootMutex.Unlock()
+
+	config, err := readConfigForKey(ctx, storage, key)
+	if err != nil {
+		return err
+	}
+	if config.ServerUrl == "" {
+		return fmt.Errorf("no connection configured at %s", key)
+	}
+	if config.authMethod() != authMethodClientSecret {
+		return fmt.Errorf("the connection at %s does not use a client secret", key)
+	}
+
+	clientSecret, err := b.regenerateClientSecretOfRealm(ctx, config.Realm, config.ClientId, config)
+	if err != nil {
+		return err
+	}
+
+	rotatedConfig := config
+	rotatedConfig.ClientSecret = clientSecret
+	rotatedConfig.LastRotated = time.Now().UTC()
+
+	// Keycloak invalidates the previous secret right away, so the new one
+	// has to be persisted before it is verified. Otherwise a failed
+	// verification would leave vault without any working credential.
+	if err := writeConfigForKey(ctx, storage, rotatedConfig, key); err != nil {
+		return err
+	}
+	b.forgetAccessToken(config)
+
+	if _, _, err := b.getClientAndAccessToken(ctx, rotatedConfig); err != nil {
+		return fmt.Errorf("stored rotated client secret, but failed to verify it: %w", err)
+	}
+
+	return nil
+}
+
+// rotateDueRootCredentials rotates the client secrets of all connections whose
+// rotation_period or rotation_schedule is due. A failed rotation keeps the
+// previous credential and is retried with an exponential backoff.
+func (b *backend) rotateDueRootCredentials(ctx context.Context, storage logical.Storage) error {
+	keys, err := connectionStorageKeys(ctx, storage)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, key := range keys {
+		config, err := readConfigForKey(ctx, storage, key)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		if !config.rotationEnabled() {
+			b.resetRotationBackoff(key)
+			continue
+		}
+
+		nextRotation, err := config.nextRotation()
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		now := time.Now()
+		if now.Before(nextRotation) || !b.rotationRetryDue(key, now) {
+			continue
+		}
+
+		if err := b.rotateRootCredential(ctx, storage, key); err != nil {
+			retryIn := b.postponeRotation(key, now)
+			b.logger.Warn("failed to rotate root credential", "key", key, "retry_in", retryIn, "error", err)
+			continue
+		}
+		b.resetRotationBackoff(key)
+	}
+
+	return errs
+}
+
+// connectionStorageKeys lists the storage keys of all configured connections.
+func connectionStorageKeys(ctx context.Context, storage logical.Storage) ([]string, error) {
+	names, err := storage.List(ctx, "config/connections/")
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, namedStorageKey(name))
+	}
+
+	realms, err := storage.List(ctx, "config/realms/")
+	if err != nil {
+		return nil, err
+	}
+	for _, realm := range realms {
+		keys = append(keys, realmSpecificStorageKey(strings.TrimSuffix(realm, "/")))
+	}
+
+	return keys, nil
+}
+
+type rotationRetry struct {
+	backoff   *backoff.Backoff
+	notBefore time.Time
+}
+
+func (b *backend) rotationRetryDue(key string, now time.Time) bool {
+	b.rotationRetryMutex.Lock()
+	defer b.rotationRetryMutex.Unlock()
+
+	retry, ok := b.rotationRetries[key]
+	return !ok || !now.Before(retry.notBefore)
+}
+
+// postponeRotation schedules the next attempt to rotate the credential stored
+// under key and returns the delay until then.
+func (b *backend) postponeRotation(key string, now time.Time) time.Duration {
+	b.rotationRetryMutex.Lock()
+	defer b.rotationRetryMutex.Unlock()
+
+	retry, ok := b.rotationRetries[key]
+	if !ok {
+		retry = &rotationRetry{
+			backoff: backoff.NewBackoff(math.MaxInt, minRotationRetryDelay, maxRotationRetryDelay),
+		}
+		b.rotationRetries[key] = retry
+	}
+
+	delay, err := retry.backoff.Next()
+	if err != nil {
+		delay = maxRotationRetryDelay
+	}
+	retry.notBefore = now.Add(delay)
+	return delay
+}
+
+func (b *backend) resetRotationBackoff(key string) {
+	b.rotationRetryMutex.Lock()
+	defer b.rotationRetryMutex.Unlock()
+
+	delete(b.rotationRetries, key)
+}
+
+func (c ConnectionConfig) rotationEnabled() bool {
+	return c.RotationPeriod > 0 || c.RotationSchedule != ""
+}
+
+func (c ConnectionConfig) validateRotation() error {
+	if c.rotationEnabled() && c.authMethod() != authMethodClientSecret {
+		return errors.New("rotation requires auth_method client_secret")
+	}
+	if c.RotationPeriod < 0 {
+		return errors.New("rotation_period must not be negative")
+	}
+	if c.RotationPeriod > 0 && c.RotationSchedule != "" {
+		return errors.New("rotation_period and rotation_schedule are mutually exclusive")
+	}
+	if c.RotationSchedule != "" {
+		if _, err := rotation.DefaultScheduler.Parse(c.RotationSchedule); err != nil {
+			return fmt.Errorf("invalid rotation_schedule: %w", err)
+		}
+	}
+	return nil
+}
+
+// nextRotation returns the time at which the client secret is due to be rotated.
+// It is counted from the last rotation or, if the secret was written or the
+// rotation enabled since, from then. A secret without either is due immediately.
+func (c ConnectionConfig) nextRotation() (time.Time, error) {
+	since := c.LastRotated
+	if c.RotationStart.After(since) {
+		since = c.RotationStart
+	}
+	if since.IsZero() {
+		return time.Now().UTC(), nil
+	}
+	if c.RotationPeriod > 0 {
+		return since.Add(c.RotationPeriod), nil
+	}
+
+	schedule, err := rotation.DefaultScheduler.Parse(c.RotationSchedule)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid rotation_schedule: %w", err)
+	}
+	return schedule.Next(since), nil
+}
@@ -0,0 +1,425 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func mockedRotatingGocloak(t *testing.T, realm, clientId, oldSecret, newSecret string) *keycloak.MockService {
+	t.Helper()
+
+	gocloakClientMock := &keycloak.MockService{}
+
+	gocloakClientMock.On("LoginClient", mock.Anything, clientId, oldSecret, realm).Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	gocloakClientMock.On("LoginClient", mock.Anything, clientId, newSecret, realm).Return(&keycloak.JWT{
+		AccessToken: "access456",
+	}, nil)
+
+	idOfVaultClient := "internalVaultId123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", realm, keycloak.GetClientsParams{
+		ClientID: &clientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfVaultClient,
+		},
+	}, nil)
+	gocloakClientMock.On("RegenerateClientSecret", mock.Anything, "access123", realm, idOfVaultClient).Return(&keycloak.CredentialRepresentation{
+		Value: &newSecret,
+	}, nil)
+
+	return gocloakClientMock
+}
+
+func TestBackend_RotateRoot(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := mockedRotatingGocloak(t, "master", "vault", "secret123", "rotated456")
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	currentConfig := ConnectionConfig{
+		ServerUrl:    "http://auth.example.com",
+		Realm:        "master",
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+	}
+	if err = writeConfig(context.Background(), config.StorageView, currentConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	rotateReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/rotate-root",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(context.Background(), rotateReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	actualConfig, err := readConfig(context.Background(), config.StorageView)
+	if err != nil {
+		t.Fatalf("unable to read configuration: %v", err)
+	}
+
+	if actualConfig.LastRotated.IsZero() {
+		t.Fatal("expected last_rotated to be set")
+	}
+	expectedConfig := currentConfig
+	expectedConfig.ClientSecret = "rotated456"
+	expectedConfig.LastRotated = actualConfig.LastRotated
+
+	if !reflect.DeepEqual(actualConfig, expectedConfig) {
+		t.Fatalf("Expected: %#v\nActual: %#v", expectedConfig, actualConfig)
+	}
+	if _, ok := b.jwt[currentConfig.key()]; ok {
+		t.Fatal("expected the access token of the old credential to be dropped")
+	}
+	gocloakClientMock.AssertCalled(t, "LoginClient", mock.Anything, "vault", "rotated456", "master")
+}
+
+func TestBackend_RotateRootForRealm(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := mockedRotatingGocloak(t, "realm1", "vault1", "realm1_secret123", "realm1_rotated456")
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	currentConfig := ConnectionConfig{
+		ServerUrl:    "http://auth1.example.com",
+		Realm:        "realm1",
+		ClientId:     "vault1",
+		ClientSecret: "realm1_secret123",
+	}
+	if err = writeConfigForKey(context.Background(), config.StorageView, currentConfig, "config/realms/realm1/connection"); err != nil {
+		t.Fatal(err)
+	}
+
+	rotateReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/realms/realm1/rotate-root",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(context.Background(), rotateReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	actualConfig, err := readConfigForKey(context.Background(), config.StorageView, "config/realms/realm1/connection")
+	if err != nil {
+		t.Fatalf("unable to read configuration: %v", err)
+	}
+
+	if actualConfig.LastRotated.IsZero() {
+		t.Fatal("expected last_rotated to be set")
+	}
+	expectedConfig := currentConfig
+	expectedConfig.ClientSecret = "realm1_rotated456"
+	expectedConfig.LastRotated = actualConfig.LastRotated
+
+	if !reflect.DeepEqual(actualConfig, expectedConfig) {
+		t.Fatalf("Expected: %#v\nActual: %#v", expectedConfig, actualConfig)
+	}
+}
+
+func TestBackend_RotateRootKeepsCredentialIfRegenerationFails(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	clientId := "vault"
+	idOfVaultClient := "internalVaultId123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "master", keycloak.GetClientsParams{
+		ClientID: &clientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfVaultClient,
+		},
+	}, nil)
+	gocloakClientMock.On("RegenerateClientSecret", mock.Anything, "access123", "master", idOfVaultClient).Return(nil, errors.New("403 Forbidden"))
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	currentConfig := ConnectionConfig{
+		ServerUrl:    "http://auth.example.com",
+		Realm:        "master",
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+	}
+	if err = writeConfig(context.Background(), config.StorageView, currentConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	rotateReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/rotate-root",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(context.Background(), rotateReq)
+	if err == nil {
+		t.Fatalf("Expected error")
+	}
+	if !resp.IsError() {
+		t.Fatalf("bad: resp: %#v is not an error\nerr:%s", resp, err)
+	}
+
+	actualConfig, err := readConfig(context.Background(), config.StorageView)
+	if err != nil {
+		t.Fatalf("unable to read configuration: %v", err)
+	}
+	if !reflect.DeepEqual(actualConfig, currentConfig) {
+		t.Fatalf("Expected: %#v\nActual: %#v", currentConfig, actualConfig)
+	}
+}
+
+func TestBackend_PeriodicRotation(t *testing.T) {
+	tests := []struct {
+		name             string
+		rotationPeriod   time.Duration
+		rotationSchedule string
+		lastRotated      time.Duration
+		expectRotation   bool
+	}{
+		{name: "rotation disabled", lastRotated: -48 * time.Hour},
+		{name: "never rotated", rotationPeriod: time.Hour, expectRotation: true},
+		{name: "period elapsed", rotationPeriod: time.Hour, lastRotated: -61 * time.Minute, expectRotation: true},
+		{name: "period not elapsed", rotationPeriod: time.Hour, lastRotated: -30 * time.Minute},
+		{name: "schedule due", rotationSchedule: "0 * * * *", lastRotated: -61 * time.Minute, expectRotation: true},
+		{name: "schedule not due", rotationSchedule: "0 12 * * *", lastRotated: -time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				config := logical.TestBackendConfig()
+				config.StorageView = &logical.InmemStorage{}
+				b, err := newBackend(config)
+				require.NoError(t, err)
+
+				gocloakClientMock := mockedRotatingGocloak(t, "master", "vault", "secret123", "rotated456")
+				b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+				require.NoError(t, b.Setup(t.Context(), config))
+
+				currentConfig := ConnectionConfig{
+					ServerUrl:        "http://auth.example.com",
+					Realm:            "master",
+					ClientId:         "vault",
+					ClientSecret:     "secret123",
+					RotationPeriod:   test.rotationPeriod,
+					RotationSchedule: test.rotationSchedule,
+				}
+				if test.lastRotated != 0 {
+					currentConfig.LastRotated = time.Now().Add(test.lastRotated).UTC()
+				}
+				require.NoError(t, writeConfig(t.Context(), config.StorageView, currentConfig))
+
+				require.NoError(t, b.periodicFunc(t.Context(), &logical.Request{Storage: config.StorageView}))
+
+				actualConfig, err := readConfig(t.Context(), config.StorageView)
+				require.NoError(t, err)
+				if test.expectRotation {
+					require.Equal(t, "rotated456", actualConfig.ClientSecret)
+					require.Equal(t, time.Now().UTC(), actualConfig.LastRotated)
+				} else {
+					require.Equal(t, currentConfig, actualConfig)
+					gocloakClientMock.AssertNotCalled(t, "RegenerateClientSecret", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				}
+			})
+		})
+	}
+}
+
+func TestBackend_PeriodicRotationRetriesWithBackoff(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		config := logical.TestBackendConfig()
+		config.StorageView = &logical.InmemStorage{}
+		b, err := newBackend(config)
+		require.NoError(t, err)
+
+		gocloakClientMock := &keycloak.MockService{}
+		gocloakClientMock.On("LoginClient", mock.Anything, "vault1", "realm1_secret123", "realm1").Return(&keycloak.JWT{
+			AccessToken: "access123",
+		}, nil)
+		clientId := "vault1"
+		idOfVaultClient := "internalVaultId123"
+		gocloakClientMock.On("GetClients", mock.Anything, "access123", "realm1", keycloak.GetClientsParams{
+			ClientID: &clientId,
+		}).Return([]*keycloak.Client{
+			{
+				ID: &idOfVaultClient,
+			},
+		}, nil)
+		gocloakClientMock.On("RegenerateClientSecret", mock.Anything, "access123", "realm1", idOfVaultClient).Return(nil, errors.New("Keycloak not available"))
+
+		b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+		require.NoError(t, b.Setup(t.Context(), config))
+
+		currentConfig := ConnectionConfig{
+			ServerUrl:      "http://auth1.example.com",
+			Realm:          "realm1",
+			ClientId:       "vault1",
+			ClientSecret:   "realm1_secret123",
+			RotationPeriod: time.Hour,
+			LastRotated:    time.Now().Add(-2 * time.Hour).UTC(),
+		}
+		require.NoError(t, writeConfigForKey(t.Context(), config.StorageView, currentConfig, "config/realms/realm1/connection"))
+
+		periodicReq := &logical.Request{Storage: config.StorageView}
+
+		// The failed rotation keeps the current credential.
+		require.NoError(t, b.periodicFunc(t.Context(), periodicReq))
+		actualConfig, err := readConfigForKey(t.Context(), config.StorageView, "config/realms/realm1/connection")
+		require.NoError(t, err)
+		require.Equal(t, currentConfig, actualConfig)
+		gocloakClientMock.AssertNumberOfCalls(t, "RegenerateClientSecret", 1)
+
+		// The next attempt is postponed.
+		time.Sleep(time.Second)
+		require.NoError(t, b.periodicFunc(t.Context(), periodicReq))
+		gocloakClientMock.AssertNumberOfCalls(t, "RegenerateClientSecret", 1)
+
+		// And retried after the backoff.
+		time.Sleep(minRotationRetryDelay)
+		require.NoError(t, b.periodicFunc(t.Context(), periodicReq))
+		gocloakClientMock.AssertNumberOfCalls(t, "RegenerateClientSecret", 2)
+	})
+}
+
+func TestBackend_PeriodicRotationStartsWhenEnabled(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		config := logical.TestBackendConfig()
+		config.StorageView = &logical.InmemStorage{}
+		b, err := newBackend(config)
+		require.NoError(t, err)
+
+		gocloakClientMock := mockedRotatingGocloak(t, "master", "vault", "secret123", "rotated456")
+		b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+		require.NoError(t, b.Setup(t.Context(), config))
+
+		resp, err := b.HandleRequest(t.Context(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "config/connection",
+			Storage:   config.StorageView,
+			Data: map[string]interface{}{
+				"server_url":    "http://auth.example.com",
+				"realm":         "master",
+				"client_id":     "vault",
+				"client_secret": "secret123",
+			},
+		})
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+
+		// enabling the rotation on an existing connection does not rotate right away
+		time.Sleep(48 * time.Hour)
+		resp, err = b.HandleRequest(t.Context(), &logical.Request{
+			Operation: logical.PatchOperation,
+			Path:      "config/connection",
+			Storage:   config.StorageView,
+			Data:      map[string]interface{}{"rotation_period": "1h"},
+		})
+		require.NoError(t, err)
+		require.False(t, resp.IsError())
+
+		require.NoError(t, b.periodicFunc(t.Context(), &logical.Request{Storage: config.StorageView}))
+		actualConfig, err := readConfig(t.Context(), config.StorageView)
+		require.NoError(t, err)
+		require.Equal(t, "secret123", actualConfig.ClientSecret)
+		nextRotation, err := actualConfig.nextRotation()
+		require.NoError(t, err)
+		require.Equal(t, time.Now().UTC().Add(time.Hour), nextRotation)
+
+		time.Sleep(time.Hour)
+		require.NoError(t, b.periodicFunc(t.Context(), &logical.Request{Storage: config.StorageView}))
+		actualConfig, err = readConfig(t.Context(), config.StorageView)
+		require.NoError(t, err)
+		require.Equal(t, "rotated456", actualConfig.ClientSecret)
+	})
+}
+
+func TestBackend_ConfigUpdateDoesNotOverwriteRotation(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(t.Context(), config))
+	require.NoError(t, writeConfig(t.Context(), config.StorageView, ConnectionConfig{
+		ServerUrl:    "http://auth.example.com",
+		Realm:        "master",
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+	}))
+
+	// a rotation is in progress while the connection is updated
+	b.rotateRootMutex.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.PatchOperation,
+			Path:      "config/connection",
+			Storage:   config.StorageView,
+			Data:      map[string]interface{}{"rotation_period": "1h"},
+		})
+		assert.NoError(t, err)
+		assert.False(t, resp.IsError())
+	}()
+	select {
+	case <-done:
+		t.Fatal("the update did not wait for the rotation")
+	case <-time.After(50 * time.Millisecond):
+	}
+	rotated, err := readConfig(t.Context(), config.StorageView)
+	require.NoError(t, err)
+	rotated.ClientSecret = "rotated456"
+	require.NoError(t, writeConfig(t.Context(), config.StorageView, rotated))
+	b.rotateRootMutex.Unlock()
+	<-done
+
+	actualConfig, err := readConfig(t.Context(), config.StorageView)
+	require.NoError(t, err)
+	require.Equal(t, "rotated456", actualConfig.ClientSecret)
+	require.Equal(t, time.Hour, actualConfig.RotationPeriod)
+}
@@ -0,0 +1,254 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/base62"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const secretTypeClient = "keycloak_client"
+
+func pathCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathCredsRead,
+		},
+	}
+}
+
+func secretClient(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: secretTypeClient,
+		Fields: map[string]*framework.FieldSchema{
+			"client_id": {
+				Type:        framework.TypeString,
+				Description: "Id of the created client",
+			},
+			"client_secret": {
+				Type:        framework.TypeString,
+				Description: "Secret of the created client",
+			},
+		},
+
+		Renew:  b.secretClientRenew,
+		Revoke: b.secretClientRevoke,
+	}
+}
+
+func (b *backend) pathCredsRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	role, err := readDynamicClientRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse("unknown role: %s", name), nil
+	}
+
+	config, err := readConfigForRealm(ctx, req.Storage, role.Realm)
+	if err != nil {
+		return logical.ErrorResponse("failed to read config"), err
+	}
+	if err := config.checkRealm(role.Realm); err != nil {
+		return accessDenied(err)
+	}
+	// the connection's restrictions may have changed since the role was written
+	if err := config.checkClientRoles(role.Realm, role.ClientRoles); err != nil {
+		return accessDenied(err)
+	}
+
+	goclaokClient, token, err := b.getClientAndAccessToken(ctx, config)
+	if err != nil {
+		return logical.ErrorResponse("failed to access keycloak"), err
+	}
+
+	suffix, err := base62.Random(12)
+	if err != nil {
+		return nil, err
+	}
+	clientId := fmt.Sprintf("vault-%s-%s", name, strings.ToLower(suffix))
+
+	idOfClient, err := createDynamicClient(ctx, goclaokClient, token, clientId, name, role)
+	if err != nil {
+		return logical.ErrorResponse("could not create client"), err
+	}
+
+	clientSecret, err := setupDynamicClient(ctx, goclaokClient, token, idOfClient, role)
+	if err != nil {
+		// do not leave a half configured client behind
+		if deleteErr := goclaokClient.DeleteClient(ctx, token.AccessToken, role.Realm, idOfClient); deleteErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to delete client %s: %w", clientId, deleteErr))
+		}
+		return logical.ErrorResponse("could not set up client"), err
+	}
+
+	openidConfig, err := b.getGetWellKnownOpenidConfiguration(ctx, config, role.Realm)
+	if err != nil {
+		if deleteErr := goclaokClient.DeleteClient(ctx, token.AccessToken, role.Realm, idOfClient); deleteErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to delete client %s: %w", clientId, deleteErr))
+		}
+		return logical.ErrorResponse("could not retrieve issuer"), err
+	}
+
+	response := b.Secret(secretTypeClient).Response(map[string]interface{}{
+		"client_id":     clientId,
+		"client_secret": clientSecret,
+		"issuer":        openidConfig.Issuer,
+	}, map[string]interface{}{
+		"role":         name,
+		"realm":        role.Realm,
+		"client_id":    clientId,
+		"id_of_client": idOfClient,
+	})
+	response.Secret.TTL = role.TTL
+	response.Secret.MaxTTL = role.MaxTTL
+
+	return response, nil
+}
+
+func createDynamicClient(ctx context.Context, goclaokClient keycloak.Service, token *keycloak.JWT, clientId string, roleName string, role *dynamicClientRole) (string, error) {
+	enabled := true
+	publicClient := false
+	standardFlowEnabled := len(role.RedirectURIs) > 0
+	description := fmt.Sprintf("Created by vault for role %s", roleName)
+
+	client := keycloak.Client{
+		ClientID:               &clientId,
+		Description:            &description,
+		Protocol:               &role.Protocol,
+		Enabled:                &enabled,
+		PublicClient:           &publicClient,
+		ServiceAccountsEnabled: &enabled,
+		StandardFlowEnabled:    &standardFlowEnabled,
+	}
+	if len(role.RedirectURIs) > 0 {
+		client.RedirectURIs = &role.RedirectURIs
+	}
+	if len(role.DefaultScopes) > 0 {
+		client.DefaultClientScopes = &role.DefaultScopes
+	}
+	if len(role.OptionalScopes) > 0 {
+		client.OptionalClientScopes = &role.OptionalScopes
+	}
+
+	return goclaokClient.CreateClient(ctx, token.AccessToken, role.Realm, client)
+}
+
+// setupDynamicClient grants the roles to the service account of the freshly
+// created client and returns the secret of the client.
+func setupDynamicClient(ctx context.Context, goclaokClient keycloak.Service, token *keycloak.JWT, idOfClient string, role *dynamicClientRole) (string, error) {
+	if len(role.RealmRoles) > 0 || len(role.ClientRoles) > 0 {
+		serviceAccount, err := goclaokClient.GetClientServiceAccount(ctx, token.AccessToken, role.Realm, idOfClient)
+		if err != nil {
+			return "", err
+		}
+		if err := grantRoles(ctx, goclaokClient, token, role.Realm, *serviceAccount.ID, role.RealmRoles, role.ClientRoles); err != nil {
+			return "", err
+		}
+	}
+
+	creds, err := goclaokClient.GetClientSecret(ctx, token.AccessToken, role.Realm, idOfClient)
+	if err != nil {
+		return "", err
+	}
+	if creds == nil || creds.Value == nil {
+		return "", errors.New("keycloak returned no client secret")
+	}
+	return *creds.Value, nil
+}
+
+// grantRoles assigns realm roles and client roles, the latter in the form
+// <client-id>/<role>, to the user with userID.
+func grantRoles(ctx context.Context, goclaokClient keycloak.Service, token *keycloak.JWT, realm string, userID string, realmRoles []string, clientRoles []string) error {
+	if len(realmRoles) > 0 {
+		roles := make([]keycloak.Role, len(realmRoles))
+		for i, roleName := range realmRoles {
+			role, err := goclaokClient.GetRealmRole(ctx, token.AccessToken, realm, roleName)
+			if err != nil {
+				return fmt.Errorf("failed to get realm role %s: %w", roleName, err)
+			}
+			roles[i] = *role
+		}
+		if err := goclaokClient.AddRealmRoleToUser(ctx, token.AccessToken, realm, userID, roles); err != nil {
+			return fmt.Errorf("failed to grant realm roles: %w", err)
+		}
+	}
+
+	for _, clientRole := range clientRoles {
+		clientId, roleName, _ := strings.Cut(clientRole, "/")
+		client, err := findClient(ctx, goclaokClient, token, realm, clientId)
+		if err != nil {
+			return err
+		}
+		role, err := goclaokClient.GetClientRole(ctx, token.AccessToken, realm, *client.ID, roleName)
+		if err != nil {
+			return fmt.Errorf("failed to get client role %s: %w", clientRole, err)
+		}
+		if err := goclaokClient.AddClientRolesToUser(ctx, token.AccessToken, realm, *client.ID, userID, []keycloak.Role{*role}); err != nil {
+			return fmt.Errorf("failed to grant client role %s: %w", clientRole, err)
+		}
+	}
+
+	return nil
+}
+
+func (b *backend) secretClientRenew(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name, ok := req.Secret.InternalData["role"].(string)
+	if !ok {
+		return nil, errors.New("secret is missing role internal data")
+	}
+	role, err := readDynamicClientRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s does not exist anymore", name)
+	}
+
+	response := &logical.Response{Secret: req.Secret}
+	response.Secret.TTL = role.TTL
+	response.Secret.MaxTTL = role.MaxTTL
+	return response, nil
+}
+
+func (b *backend) secretClientRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	realm, ok := req.Secret.InternalData["realm"].(string)
+	if !ok {
+		return nil, errors.New("secret is missing realm internal data")
+	}
+	idOfClient, ok := req.Secret.InternalData["id_of_client"].(string)
+	if !ok {
+		return nil, errors.New("secret is missing id_of_client internal data")
+	}
+
+	config, err := readConfigForRealm(ctx, req.Storage, realm)
+	if err != nil {
+		return nil, err
+	}
+
+	goclaokClient, token, err := b.getClientAndAccessToken(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = goclaokClient.DeleteClient(ctx, token.AccessToken, realm, idOfClient)
+	if err != nil && !keycloak.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to delete client %v: %w", req.Secret.InternalData["client_id"], err)
+	}
+
+	return nil, nil
+}
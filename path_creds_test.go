@@ -0,0 +1,212 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBackend_ReadCredsAndRevoke(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+
+	idOfCreatedClient := "created123"
+	gocloakClientMock.On("CreateClient", mock.Anything, "access123", "somerealm", mock.MatchedBy(func(client keycloak.Client) bool {
+		return strings.HasPrefix(*client.ClientID, "vault-ci-") &&
+			*client.Protocol == "openid-connect" &&
+			*client.ServiceAccountsEnabled &&
+			!*client.PublicClient &&
+			reflect.DeepEqual(*client.DefaultClientScopes, []string{"profile"})
+	})).Return(idOfCreatedClient, nil)
+
+	serviceAccountId := "serviceAccount123"
+	gocloakClientMock.On("GetClientServiceAccount", mock.Anything, "access123", "somerealm", idOfCreatedClient).Return(&keycloak.User{
+		ID: &serviceAccountId,
+	}, nil)
+	realmRoleName := "offline_access"
+	gocloakClientMock.On("GetRealmRole", mock.Anything, "access123", "somerealm", realmRoleName).Return(&keycloak.Role{
+		Name: &realmRoleName,
+	}, nil)
+	gocloakClientMock.On("AddRealmRoleToUser", mock.Anything, "access123", "somerealm", serviceAccountId, []keycloak.Role{{Name: &realmRoleName}}).Return(nil)
+
+	realmManagementClientId := "realm-management"
+	idOfRealmManagement := "realmManagement123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "somerealm", keycloak.GetClientsParams{
+		ClientID: &realmManagementClientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfRealmManagement,
+		},
+	}, nil)
+	clientRoleName := "view-users"
+	gocloakClientMock.On("GetClientRole", mock.Anything, "access123", "somerealm", idOfRealmManagement, clientRoleName).Return(&keycloak.Role{
+		Name: &clientRoleName,
+	}, nil)
+	gocloakClientMock.On("AddClientRolesToUser", mock.Anything, "access123", "somerealm", idOfRealmManagement, serviceAccountId, []keycloak.Role{{Name: &clientRoleName}}).Return(nil)
+
+	secretValue := "dynamicsecret123"
+	gocloakClientMock.On("GetClientSecret", mock.Anything, "access123", "somerealm", idOfCreatedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	gocloakClientMock.On("GetWellKnownOpenidConfiguration", mock.Anything, "somerealm").Return(&keycloak.WellKnownOpenidConfiguration{
+		Issuer: "THIS_IS_THE_ISSUER",
+	}, nil)
+	gocloakClientMock.On("DeleteClient", mock.Anything, "access123", "somerealm", idOfCreatedClient).Return(nil)
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	// realm-management is denied by default
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "master",
+		ServerUrl:    "http://example.com/auth",
+		AccessConfig: AccessConfig{DeniedClientIds: []string{}},
+	})
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/ci",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"realm":          "somerealm",
+			"realm_roles":    "offline_access",
+			"client_roles":   "realm-management/view-users",
+			"default_scopes": "profile",
+			"ttl":            "1h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/ci",
+		Storage:   config.StorageView,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	if !strings.HasPrefix(resp.Data["client_id"].(string), "vault-ci-") {
+		t.Fatalf("unexpected client_id %v", resp.Data["client_id"])
+	}
+	if resp.Data["client_secret"] != secretValue || resp.Data["issuer"] != "THIS_IS_THE_ISSUER" {
+		t.Fatalf("unexpected response %#v", resp.Data)
+	}
+	if resp.Secret == nil || resp.Secret.TTL != time.Hour {
+		t.Fatalf("expected a lease of 1h, got %#v", resp.Secret)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   config.StorageView,
+		Secret:    resp.Secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+	gocloakClientMock.AssertCalled(t, "DeleteClient", mock.Anything, "access123", "somerealm", idOfCreatedClient)
+}
+
+func TestBackend_ReadCredsDeletesClientIfSetupFails(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	idOfCreatedClient := "created123"
+	gocloakClientMock.On("CreateClient", mock.Anything, "access123", "somerealm", mock.Anything).Return(idOfCreatedClient, nil)
+	serviceAccountId := "serviceAccount123"
+	gocloakClientMock.On("GetClientServiceAccount", mock.Anything, "access123", "somerealm", idOfCreatedClient).Return(&keycloak.User{
+		ID: &serviceAccountId,
+	}, nil)
+	gocloakClientMock.On("GetRealmRole", mock.Anything, "access123", "somerealm", "does-not-exist").Return(nil, errors.New("404 Not Found"))
+	gocloakClientMock.On("DeleteClient", mock.Anything, "access123", "somerealm", idOfCreatedClient).Return(nil)
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "master",
+		ServerUrl:    "http://example.com/auth",
+	})
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/ci",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"realm":       "somerealm",
+			"realm_roles": "does-not-exist",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/ci",
+		Storage:   config.StorageView,
+	})
+	if err == nil || (resp == nil || !resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+	gocloakClientMock.AssertCalled(t, "DeleteClient", mock.Anything, "access123", "somerealm", idOfCreatedClient)
+}
+
+func TestBackend_ReadCredsOfUnknownRole(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/unknown",
+		Storage:   config.StorageView,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+}
@@ -0,0 +1,74 @@
+package keycloak
+
+import (
+	"context"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const includeDiscoveryDescription = "Include the endpoints of the realm's OpenID Connect discovery document in the response."
+
+func pathRealmOpenidConfiguration(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "realms/" + framework.GenericNameRegex("realm") + "/openid-configuration",
+		Fields: map[string]*framework.FieldSchema{
+			"realm": {
+				Type:        framework.TypeString,
+				Description: "Name of the realm.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathRealmOpenidConfigurationRead,
+		},
+	}
+}
+
+func (b *backend) pathRealmOpenidConfigurationRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	realm := d.Get("realm").(string)
+	if realm == "" {
+		return logical.ErrorResponse("missing realm"), nil
+	}
+
+	config, err := readConfigForRequest(ctx, req.Storage, d, realm)
+	if err != nil {
+		return logical.ErrorResponse("failed to read config"), err
+	}
+	if err := config.checkRealm(realm); err != nil {
+		return accessDenied(err)
+	}
+
+	openidConfig, err := b.getGetWellKnownOpenidConfiguration(ctx, config, realm)
+	if err != nil {
+		return logical.ErrorResponse("could not retrieve openid configuration"), err
+	}
+
+	response := &logical.Response{
+		Data: map[string]interface{}{},
+	}
+	addDiscovery(response.Data, openidConfig)
+
+	return response, nil
+}
+
+// addDiscovery adds the OpenID Connect discovery metadata to the data of a response.
+func addDiscovery(data map[string]interface{}, openidConfig *keycloak.WellKnownOpenidConfiguration) {
+	data["issuer"] = openidConfig.Issuer
+	data["authorization_endpoint"] = openidConfig.AuthorizationEndpoint
+	data["token_endpoint"] = openidConfig.TokenEndpoint
+	data["introspection_endpoint"] = openidConfig.IntrospectionEndpoint
+	data["userinfo_endpoint"] = openidConfig.UserinfoEndpoint
+	data["end_session_endpoint"] = openidConfig.EndSessionEndpoint
+	data["revocation_endpoint"] = openidConfig.RevocationEndpoint
+	data["device_authorization_endpoint"] = openidConfig.DeviceAuthorizationEndpoint
+	data["jwks_uri"] = openidConfig.JwksURI
+	data["grant_types_supported"] = openidConfig.GrantTypesSupported
+	data["response_types_supported"] = openidConfig.ResponseTypesSupported
+	data["scopes_supported"] = openidConfig.ScopesSupported
+	data["claims_supported"] = openidConfig.ClaimsSupported
+	data["token_endpoint_auth_methods_supported"] = openidConfig.TokenEndpointAuthMethodsSupported
+	data["id_token_signing_alg_values_supported"] = openidConfig.IDTokenSigningAlgValuesSupported
+	data["code_challenge_methods_supported"] = openidConfig.CodeChallengeMethodsSupported
+}
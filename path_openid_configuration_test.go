@@ -0,0 +1,107 @@
+package keycloak
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func discoveryDocument() *keycloak.WellKnownOpenidConfiguration {
+	return &keycloak.WellKnownOpenidConfiguration{
+		Issuer:                "https://auth.example.com/realms/somerealm",
+		AuthorizationEndpoint: "https://auth.example.com/realms/somerealm/protocol/openid-connect/auth",
+		TokenEndpoint:         "https://auth.example.com/realms/somerealm/protocol/openid-connect/token",
+		UserinfoEndpoint:      "https://auth.example.com/realms/somerealm/protocol/openid-connect/userinfo",
+		EndSessionEndpoint:    "https://auth.example.com/realms/somerealm/protocol/openid-connect/logout",
+		JwksURI:               "https://auth.example.com/realms/somerealm/protocol/openid-connect/certs",
+		GrantTypesSupported:   []string{"authorization_code", "client_credentials"},
+	}
+}
+
+func TestBackend_ReadRealmOpenidConfiguration(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("GetWellKnownOpenidConfiguration", mock.Anything, "somerealm").Return(discoveryDocument(), nil)
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	require.NoError(t, b.Setup(context.Background(), config))
+
+	require.NoError(t, writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "master",
+		ServerUrl:    "https://auth.example.com",
+	}))
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "realms/somerealm/openid-configuration",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	require.Equal(t, "https://auth.example.com/realms/somerealm", resp.Data["issuer"])
+	require.Equal(t, "https://auth.example.com/realms/somerealm/protocol/openid-connect/token", resp.Data["token_endpoint"])
+	require.Equal(t, "https://auth.example.com/realms/somerealm/protocol/openid-connect/certs", resp.Data["jwks_uri"])
+	require.Equal(t, []string{"authorization_code", "client_credentials"}, resp.Data["grant_types_supported"])
+}
+
+func TestBackend_ReadClientSecretIncludingDiscovery(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	requestedClientId := "myclient"
+	idOfRequestedClient := "123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "somerealm", keycloak.GetClientsParams{
+		ClientID: &requestedClientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfRequestedClient,
+		},
+	}, nil)
+	secretValue := "mysecret123"
+	gocloakClientMock.On("GetClientSecret", mock.Anything, "access123", "somerealm", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	gocloakClientMock.On("GetWellKnownOpenidConfiguration", mock.Anything, "somerealm").Return(discoveryDocument(), nil)
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	require.NoError(t, b.Setup(context.Background(), config))
+
+	require.NoError(t, writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "master",
+		ServerUrl:    "https://auth.example.com",
+	}))
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "realms/somerealm/clients/myclient/secret",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"include_discovery": true,
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.IsError())
+
+	require.Equal(t, "mysecret123", resp.Data["client_secret"])
+	require.Equal(t, "myclient", resp.Data["client_id"])
+	require.Equal(t, "https://auth.example.com/realms/somerealm", resp.Data["issuer"])
+	require.Equal(t, "https://auth.example.com/realms/somerealm/protocol/openid-connect/auth", resp.Data["authorization_endpoint"])
+	require.Equal(t, "https://auth.example.com/realms/somerealm/protocol/openid-connect/logout", resp.Data["end_session_endpoint"])
+}
@@ -0,0 +1,233 @@
+package keycloak
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	rolesStoragePrefix = "roles/"
+
+	defaultClientProtocol = "openid-connect"
+)
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRolesList,
+		},
+	}
+}
+
+func pathRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"realm": {
+				Type:        framework.TypeString,
+				Description: "Name of the realm in which the clients are created",
+			},
+			"protocol": {
+				Type:        framework.TypeString,
+				Description: "Protocol of the created clients",
+				Default:     defaultClientProtocol,
+			},
+			"realm_roles": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Realm roles that are granted to the service account of the created clients",
+			},
+			"client_roles": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Client roles that are granted to the service account of the created clients, each in the form <client-id>/<role>",
+			},
+			"default_scopes": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Default client scopes of the created clients",
+			},
+			"optional_scopes": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Optional client scopes of the created clients",
+			},
+			"redirect_uris": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Valid redirect URIs of the created clients. If set, the standard flow is enabled",
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Default lease duration of the created clients",
+			},
+			"max_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum lease duration of the created clients",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRoleUpdate,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+	}
+}
+
+func (b *backend) pathRolesList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List(ctx, rolesStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing name"), nil
+	}
+
+	role, err := readDynamicClientRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &dynamicClientRole{}
+	}
+
+	if realm, ok := d.GetOk("realm"); ok {
+		role.Realm = realm.(string)
+	}
+	if role.Realm == "" {
+		return logical.ErrorResponse("missing realm"), nil
+	}
+	if protocol, ok := d.GetOk("protocol"); ok {
+		role.Protocol = protocol.(string)
+	} else if role.Protocol == "" {
+		role.Protocol = d.Get("protocol").(string)
+	}
+	if realmRoles, ok := d.GetOk("realm_roles"); ok {
+		role.RealmRoles = realmRoles.([]string)
+	}
+	if clientRoles, ok := d.GetOk("client_roles"); ok {
+		role.ClientRoles = clientRoles.([]string)
+	}
+	if err := validateClientRoles(role.ClientRoles); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	config, err := readConfigForRealm(ctx, req.Storage, role.Realm)
+	if err != nil {
+		return logical.ErrorResponse("failed to read config"), err
+	}
+	if err := config.checkClientRoles(role.Realm, role.ClientRoles); err != nil {
+		return accessDenied(err)
+	}
+	if defaultScopes, ok := d.GetOk("default_scopes"); ok {
+		role.DefaultScopes = defaultScopes.([]string)
+	}
+	if optionalScopes, ok := d.GetOk("optional_scopes"); ok {
+		role.OptionalScopes = optionalScopes.([]string)
+	}
+	if redirectURIs, ok := d.GetOk("redirect_uris"); ok {
+		role.RedirectURIs = redirectURIs.([]string)
+	}
+	if ttl, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttl.(int)) * time.Second
+	}
+	if maxTTL, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(maxTTL.(int)) * time.Second
+	}
+	if role.MaxTTL > 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl must not be greater than max_ttl"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(rolesStoragePrefix+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathRoleRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := readDynamicClientRole(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"realm":           role.Realm,
+			"protocol":        role.Protocol,
+			"realm_roles":     role.RealmRoles,
+			"client_roles":    role.ClientRoles,
+			"default_scopes":  role.DefaultScopes,
+			"optional_scopes": role.OptionalScopes,
+			"redirect_uris":   role.RedirectURIs,
+			"ttl":             int64(role.TTL.Seconds()),
+			"max_ttl":         int64(role.MaxTTL.Seconds()),
+		},
+	}
+	return response, nil
+}
+
+func (b *backend) pathRoleDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete(ctx, rolesStoragePrefix+d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func readDynamicClientRole(ctx context.Context, storage logical.Storage, name string) (*dynamicClientRole, error) {
+	entry, err := storage.Get(ctx, rolesStoragePrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var role dynamicClientRole
+	if err := entry.DecodeJSON(&role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// validateClientRoles checks that each client role is given as <client-id>/<role>.
+func validateClientRoles(clientRoles []string) error {
+	for _, clientRole := range clientRoles {
+		clientId, roleName, ok := strings.Cut(clientRole, "/")
+		if !ok || clientId == "" || roleName == "" {
+			return fmt.Errorf("client role %q is not of the form <client-id>/<role>", clientRole)
+		}
+	}
+	return nil
+}
+
+// dynamicClientRole is a template for the clients that are created when reading creds/:name.
+type dynamicClientRole struct {
+	Realm          string        `json:"realm"`
+	Protocol       string        `json:"protocol"`
+	RealmRoles     []string      `json:"realm_roles"`
+	ClientRoles    []string      `json:"client_roles"`
+	DefaultScopes  []string      `json:"default_scopes"`
+	OptionalScopes []string      `json:"optional_scopes"`
+	RedirectURIs   []string      `json:"redirect_uris"`
+	TTL            time.Duration `json:"ttl"`
+	MaxTTL         time.Duration `json:"max_ttl"`
+}
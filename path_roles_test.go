@@ -0,0 +1,212 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestBackend_Roles(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	// realm-management and account are denied by default
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "master",
+		ServerUrl:    "http://example.com/auth",
+		AccessConfig: AccessConfig{DeniedClientIds: []string{}},
+	})
+
+	writeReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/ci",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"realm":         "somerealm",
+			"realm_roles":   "offline_access",
+			"client_roles":  "realm-management/view-users,account/view-profile",
+			"redirect_uris": []string{"https://ci.example.com/callback"},
+			"ttl":           "1h",
+			"max_ttl":       "24h",
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), writeReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	// a partial update keeps the other fields
+	updateReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/ci",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"default_scopes": "profile,email",
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), updateReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	readReq := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roles/ci",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(context.Background(), readReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	expectedRoleData := map[string]interface{}{
+		"realm":           "somerealm",
+		"protocol":        "openid-connect",
+		"realm_roles":     []string{"offline_access"},
+		"client_roles":    []string{"realm-management/view-users", "account/view-profile"},
+		"default_scopes":  []string{"profile", "email"},
+		"optional_scopes": []string(nil),
+		"redirect_uris":   []string{"https://ci.example.com/callback"},
+		"ttl":             int64(3600),
+		"max_ttl":         int64(86400),
+	}
+	if !reflect.DeepEqual(resp.Data, expectedRoleData) {
+		t.Fatalf("Expected: %#v\nActual: %#v", expectedRoleData, resp.Data)
+	}
+
+	listReq := &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "roles/",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(context.Background(), listReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"ci"}) {
+		t.Fatalf("Expected: %#v\nActual: %#v", []string{"ci"}, resp.Data["keys"])
+	}
+
+	deleteReq := &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "roles/ci",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(context.Background(), deleteReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), readReq)
+	if err != nil || resp != nil {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+}
+
+func TestBackend_RoleValidation(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+	}{
+		{name: "missing realm", data: map[string]interface{}{}},
+		{name: "malformed client role", data: map[string]interface{}{"realm": "somerealm", "client_roles": "view-users"}},
+		{name: "ttl above max_ttl", data: map[string]interface{}{"realm": "somerealm", "ttl": "2h", "max_ttl": "1h"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "roles/invalid",
+				Storage:   config.StorageView,
+				Data:      test.data,
+			})
+			if err != nil || resp == nil || !resp.IsError() {
+				t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+			}
+		})
+	}
+}
+
+func TestBackend_RoleRejectsClientRolesOfDeniedClients(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	connection := ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "master",
+		ServerUrl:    "http://example.com/auth",
+	}
+	writeConfig(context.Background(), config.StorageView, connection)
+
+	// realm-management is denied by default
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/admin",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"realm":        "somerealm",
+			"client_roles": "realm-management/realm-admin",
+		},
+	})
+	if !errors.Is(err, logical.ErrPermissionDenied) || resp == nil || !resp.IsError() {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/ci",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"realm":        "somerealm",
+			"client_roles": "myapp/deploy",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	// once the client is denied, its roles are not granted anymore
+	connection.DeniedClientIds = []string{"myapp"}
+	writeConfig(context.Background(), config.StorageView, connection)
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/ci",
+		Storage:   config.StorageView,
+	})
+	if !errors.Is(err, logical.ErrPermissionDenied) || resp == nil || !resp.IsError() {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+}
@@ -0,0 +1,62 @@
+package keycloak
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathStaticCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the static role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathStaticCredsRead,
+		},
+	}
+}
+
+func (b *backend) pathStaticCredsRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	role, err := readStaticRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse("unknown static role: %s", name), nil
+	}
+	// the stored secret is not served once the connection must not serve the client
+	config, err := readConfigForRealm(ctx, req.Storage, role.Realm)
+	if err != nil {
+		return logical.ErrorResponse("failed to read config"), err
+	}
+	if err := config.checkClient(role.Realm, role.ClientId); err != nil {
+		return accessDenied(err)
+	}
+
+	ttl := time.Until(role.nextRotation())
+	if ttl < 0 {
+		// the rotation is overdue and happens with the next periodic run
+		ttl = 0
+	}
+
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"realm":               role.Realm,
+			"client_id":           role.ClientId,
+			"client_secret":       role.ClientSecret,
+			"last_vault_rotation": role.LastVaultRotation,
+			"rotation_period":     int64(role.RotationPeriod.Seconds()),
+			"ttl":                 int64(ttl.Seconds()),
+		},
+	}
+	return response, nil
+}
@@ -0,0 +1,304 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const staticRolesStoragePrefix = "static-roles/"
+
+func pathStaticRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-roles/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathStaticRolesList,
+		},
+	}
+}
+
+func pathStaticRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-roles/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the static role.",
+			},
+			"realm": {
+				Type:        framework.TypeString,
+				Description: "Name of the realm of the client",
+			},
+			"client_id": {
+				Type:        framework.TypeString,
+				Description: "Id of the existing client whose secret vault manages",
+			},
+			"rotation_period": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Period after which vault regenerates the client secret",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathStaticRoleUpdate,
+			logical.ReadOperation:   b.pathStaticRoleRead,
+			logical.DeleteOperation: b.pathStaticRoleDelete,
+		},
+	}
+}
+
+func (b *backend) pathStaticRolesList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List(ctx, staticRolesStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathStaticRoleUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing name"), nil
+	}
+
+	b.staticRoleMutex.Lock()
+	defer b.staticRoleMutex.Unlock()
+
+	role, err := readStaticRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	created := role == nil
+	if created {
+		role = &staticRole{}
+	}
+
+	if realm, ok := d.GetOk("realm"); ok {
+		if !created && realm.(string) != role.Realm {
+			return logical.ErrorResponse("cannot change the realm of a static role"), nil
+		}
+		role.Realm = realm.(string)
+	}
+	if role.Realm == "" {
+		return logical.ErrorResponse("missing realm"), nil
+	}
+	if clientId, ok := d.GetOk("client_id"); ok {
+		if !created && clientId.(string) != role.ClientId {
+			return logical.ErrorResponse("cannot change the client_id of a static role"), nil
+		}
+		role.ClientId = clientId.(string)
+	}
+	if role.ClientId == "" {
+		return logical.ErrorResponse("missing client_id"), nil
+	}
+	if rotationPeriod, ok := d.GetOk("rotation_period"); ok {
+		role.RotationPeriod = time.Duration(rotationPeriod.(int)) * time.Second
+	}
+	if role.RotationPeriod <= 0 {
+		return logical.ErrorResponse("rotation_period must be positive"), nil
+	}
+
+	config, err := readConfigForRealm(ctx, req.Storage, role.Realm)
+	if err != nil {
+		return logical.ErrorResponse("failed to read config"), err
+	}
+	if err := config.checkClient(role.Realm, role.ClientId); err != nil {
+		return accessDenied(err)
+	}
+	if err := config.checkNotOwnClient(role.Realm, role.ClientId); err != nil {
+		return accessDenied(err)
+	}
+
+	// A new static role takes over the client right away, so that the
+	// secret served by vault is the only valid one.
+	if created {
+		if err := b.rotateStaticRoleSecret(ctx, req.Storage, role); err != nil {
+			return logical.ErrorResponse("failed to rotate client secret"), err
+		}
+		if err := b.storeRotatedStaticRole(ctx, req.Storage, name, role); err != nil {
+			return logical.ErrorResponse("failed to store static role, write it again to take over the client"), err
+		}
+		return nil, nil
+	}
+
+	if err := writeStaticRole(ctx, req.Storage, name, role); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathStaticRoleRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := readStaticRole(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"realm":               role.Realm,
+			"client_id":           role.ClientId,
+			"rotation_period":     int64(role.RotationPeriod.Seconds()),
+			"last_vault_rotation": role.LastVaultRotation,
+		},
+	}
+	return response, nil
+}
+
+func (b *backend) pathStaticRoleDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.staticRoleMutex.Lock()
+	defer b.staticRoleMutex.Unlock()
+
+	if err := req.Storage.Delete(ctx, staticRolesStoragePrefix+name); err != nil {
+		return nil, err
+	}
+	b.resetRotationBackoff(staticRolesStoragePrefix + name)
+	return nil, nil
+}
+
+// rotateStaticRoleSecret regenerates the secret of the client of role and
+// records it in role. The caller is responsible for storing role.
+func (b *backend) rotateStaticRoleSecret(ctx context.Context, storage logical.Storage, role *staticRole) error {
+	config, err := readConfigForRealm(ctx, storage, role.Realm)
+	if err != nil {
+		return err
+	}
+	if config.ServerUrl == "" {
+		return errors.New("connection is not configured")
+	}
+	if err := config.checkClient(role.Realm, role.ClientId); err != nil {
+		return err
+	}
+	if err := config.checkNotOwnClient(role.Realm, role.ClientId); err != nil {
+		return err
+	}
+
+	clientSecret, err := b.regenerateClientSecretOfRealm(ctx, role.Realm, role.ClientId, config)
+	if err != nil {
+		return err
+	}
+
+	role.ClientSecret = clientSecret
+	role.LastVaultRotation = time.Now().UTC()
+	return nil
+}
+
+// rotateDueStaticRoles regenerates the secrets of all static roles whose
+// rotation_period has passed. A failed rotation keeps the previous secret and
+// is retried with an exponential backoff.
+func (b *backend) rotateDueStaticRoles(ctx context.Context, storage logical.Storage) error {
+	names, err := storage.List(ctx, staticRolesStoragePrefix)
+	if err != nil {
+		return err
+	}
+
+	b.staticRoleMutex.Lock()
+	defer b.staticRoleMutex.Unlock()
+
+	var errs error
+	for _, name := range names {
+		key := staticRolesStoragePrefix + name
+		role, err := readStaticRole(ctx, storage, name)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		if role == nil {
+			continue
+		}
+
+		now := time.Now()
+		if now.Before(role.nextRotation()) || !b.rotationRetryDue(key, now) {
+			continue
+		}
+
+		if err := b.rotateStaticRoleSecret(ctx, storage, role); err != nil {
+			retryIn := b.postponeRotation(key, now)
+			b.logger.Warn("failed to rotate static role", "name", name, "retry_in", retryIn, "error", err)
+			continue
+		}
+		// the rotation stays due, so that the next run regenerates the
+		// secret again rather than serving the invalid one until the period ends
+		if err := b.storeRotatedStaticRole(ctx, storage, name, role); err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		b.resetRotationBackoff(key)
+	}
+
+	return errs
+}
+
+// staticRoleWriteAttempts is how often a rotated secret is written before it is given up.
+const staticRoleWriteAttempts = 3
+
+// storeRotatedStaticRole writes role after its secret was regenerated in
+// keycloak. As the previous secret is invalid by then, the write is retried
+// until ctx is done, and a failure is logged as an error: static-creds keeps
+// serving the invalid secret until the next rotation, which is due right
+// away, succeeds.
+func (b *backend) storeRotatedStaticRole(ctx context.Context, storage logical.Storage, name string, role *staticRole) error {
+	err := writeStaticRole(ctx, storage, name, role)
+	for attempt := 1; attempt < staticRoleWriteAttempts && err != nil && ctx.Err() == nil; attempt++ {
+		timer := time.NewTimer(time.Duration(attempt) * 100 * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+		err = writeStaticRole(ctx, storage, name, role)
+	}
+	if err == nil {
+		return nil
+	}
+	b.logger.Error("failed to store the rotated secret of static role, keycloak no longer accepts the stored one", "name", name, "realm", role.Realm, "client_id", role.ClientId, "error", err)
+	return fmt.Errorf("failed to store the rotated secret of static role %s, the secret of client %s in realm %s was regenerated nonetheless: %w", name, role.ClientId, role.Realm, err)
+}
+
+func readStaticRole(ctx context.Context, storage logical.Storage, name string) (*staticRole, error) {
+	entry, err := storage.Get(ctx, staticRolesStoragePrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var role staticRole
+	if err := entry.DecodeJSON(&role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func writeStaticRole(ctx context.Context, storage logical.Storage, name string, role *staticRole) error {
+	entry, err := logical.StorageEntryJSON(staticRolesStoragePrefix+name, role)
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, entry)
+}
+
+// staticRole binds an existing client whose secret is owned and rotated by vault.
+type staticRole struct {
+	Realm             string        `json:"realm"`
+	ClientId          string        `json:"client_id"`
+	RotationPeriod    time.Duration `json:"rotation_period"`
+	ClientSecret      string        `json:"client_secret"`
+	LastVaultRotation time.Time     `json:"last_vault_rotation"`
+}
+
+func (r *staticRole) nextRotation() time.Time {
+	return r.LastVaultRotation.Add(r.RotationPeriod)
+}
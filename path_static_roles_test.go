@@ -0,0 +1,397 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func mockedStaticRoleGocloak(realm, clientId string, secrets ...string) *keycloak.MockService {
+	gocloakClientMock := &keycloak.MockService{}
+
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+
+	idOfClient := "internalId123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", realm, keycloak.GetClientsParams{
+		ClientID: &clientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfClient,
+		},
+	}, nil)
+	for _, secret := range secrets {
+		gocloakClientMock.On("RegenerateClientSecret", mock.Anything, "access123", realm, idOfClient).Return(&keycloak.CredentialRepresentation{
+			Value: &secret,
+		}, nil).Once()
+	}
+
+	return gocloakClientMock
+}
+
+func TestBackend_StaticRoleRotation(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		config := logical.TestBackendConfig()
+		config.StorageView = &logical.InmemStorage{}
+		b, err := newBackend(config)
+		require.NoError(t, err)
+
+		gocloakClientMock := mockedStaticRoleGocloak("somerealm", "myclient", "first123", "second456")
+		b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+		require.NoError(t, b.Setup(t.Context(), config))
+
+		require.NoError(t, writeConfig(t.Context(), config.StorageView, ConnectionConfig{
+			ServerUrl:    "http://auth.example.com",
+			Realm:        "master",
+			ClientId:     "vault",
+			ClientSecret: "secret123",
+		}))
+
+		resp, err := b.HandleRequest(t.Context(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "static-roles/app",
+			Storage:   config.StorageView,
+			Data: map[string]interface{}{
+				"realm":           "somerealm",
+				"client_id":       "myclient",
+				"rotation_period": "1h",
+			},
+		})
+		require.NoError(t, err)
+		require.Nil(t, resp)
+
+		readCredsReq := &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "static-creds/app",
+			Storage:   config.StorageView,
+		}
+		resp, err = b.HandleRequest(t.Context(), readCredsReq)
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{
+			"realm":               "somerealm",
+			"client_id":           "myclient",
+			"client_secret":       "first123",
+			"last_vault_rotation": time.Now().UTC(),
+			"rotation_period":     int64(3600),
+			"ttl":                 int64(3600),
+		}, resp.Data)
+
+		time.Sleep(30 * time.Minute)
+		require.NoError(t, b.periodicFunc(t.Context(), &logical.Request{Storage: config.StorageView}))
+
+		resp, err = b.HandleRequest(t.Context(), readCredsReq)
+		require.NoError(t, err)
+		require.Equal(t, "first123", resp.Data["client_secret"])
+		require.Equal(t, int64(1800), resp.Data["ttl"])
+
+		time.Sleep(30 * time.Minute)
+		require.NoError(t, b.periodicFunc(t.Context(), &logical.Request{Storage: config.StorageView}))
+
+		resp, err = b.HandleRequest(t.Context(), readCredsReq)
+		require.NoError(t, err)
+		require.Equal(t, "second456", resp.Data["client_secret"])
+		require.Equal(t, time.Now().UTC(), resp.Data["last_vault_rotation"])
+		require.Equal(t, int64(3600), resp.Data["ttl"])
+		gocloakClientMock.AssertExpectations(t)
+	})
+}
+
+func TestBackend_StaticRoleIsNotStoredIfRotationFails(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	clientId := "myclient"
+	idOfClient := "internalId123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "somerealm", keycloak.GetClientsParams{
+		ClientID: &clientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfClient,
+		},
+	}, nil)
+	gocloakClientMock.On("RegenerateClientSecret", mock.Anything, "access123", "somerealm", idOfClient).Return(nil, errors.New("403 Forbidden"))
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	require.NoError(t, b.Setup(t.Context(), config))
+
+	require.NoError(t, writeConfig(t.Context(), config.StorageView, ConnectionConfig{
+		ServerUrl:    "http://auth.example.com",
+		Realm:        "master",
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+	}))
+
+	resp, err := b.HandleRequest(t.Context(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "static-roles/app",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"realm":           "somerealm",
+			"client_id":       "myclient",
+			"rotation_period": "1h",
+		},
+	})
+	require.Error(t, err)
+	require.True(t, resp.IsError())
+
+	role, err := readStaticRole(t.Context(), config.StorageView, "app")
+	require.NoError(t, err)
+	require.Nil(t, role)
+}
+
+func TestBackend_StaticRoleUpdate(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+
+	gocloakClientMock := mockedStaticRoleGocloak("somerealm", "myclient", "first123")
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	require.NoError(t, b.Setup(t.Context(), config))
+
+	require.NoError(t, writeConfig(t.Context(), config.StorageView, ConnectionConfig{
+		ServerUrl:    "http://auth.example.com",
+		Realm:        "master",
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+	}))
+
+	resp, err := b.HandleRequest(t.Context(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "static-roles/app",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"realm":           "somerealm",
+			"client_id":       "myclient",
+			"rotation_period": "1h",
+		},
+	})
+	require.NoError(t, err)
+	require.Nil(t, resp)
+
+	resp, err = b.HandleRequest(t.Context(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "static-roles/app",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"client_id": "otherclient",
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, resp.IsError())
+
+	// changing the period does not rotate again
+	resp, err = b.HandleRequest(t.Context(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "static-roles/app",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"rotation_period": "2h",
+		},
+	})
+	require.NoError(t, err)
+	require.Nil(t, resp)
+
+	resp, err = b.HandleRequest(t.Context(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-roles/app",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "myclient", resp.Data["client_id"])
+	require.Equal(t, int64(7200), resp.Data["rotation_period"])
+	gocloakClientMock.AssertNumberOfCalls(t, "RegenerateClientSecret", 1)
+
+	resp, err = b.HandleRequest(t.Context(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "static-roles/",
+		Storage:   config.StorageView,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"app"}, resp.Data["keys"])
+}
+
+// flakyPutStorage fails the given number of writes to keys with prefix.
+type flakyPutStorage struct {
+	logical.InmemStorage
+	prefix   string
+	failures int
+}
+
+func (s *flakyPutStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	if s.failures > 0 && strings.HasPrefix(entry.Key, s.prefix) {
+		s.failures--
+		return errors.New("storage unavailable")
+	}
+	return s.InmemStorage.Put(ctx, entry)
+}
+
+func TestBackend_StaticRoleRotationRetriesStoringTheSecret(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		storage := &flakyPutStorage{prefix: staticRolesStoragePrefix}
+		config := logical.TestBackendConfig()
+		config.StorageView = storage
+		b, err := newBackend(config)
+		require.NoError(t, err)
+
+		gocloakClientMock := mockedStaticRoleGocloak("somerealm", "myclient", "first123", "second456")
+		b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+		require.NoError(t, b.Setup(t.Context(), config))
+
+		require.NoError(t, writeConfig(t.Context(), storage, ConnectionConfig{
+			ServerUrl:    "http://auth.example.com",
+			Realm:        "master",
+			ClientId:     "vault",
+			ClientSecret: "secret123",
+		}))
+		resp, err := b.HandleRequest(t.Context(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "static-roles/app",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"realm":           "somerealm",
+				"client_id":       "myclient",
+				"rotation_period": "1h",
+			},
+		})
+		require.NoError(t, err)
+		require.Nil(t, resp)
+
+		time.Sleep(time.Hour)
+		storage.failures = staticRoleWriteAttempts - 1
+		require.NoError(t, b.periodicFunc(t.Context(), &logical.Request{Storage: storage}))
+
+		role, err := readStaticRole(t.Context(), storage, "app")
+		require.NoError(t, err)
+		require.Equal(t, "second456", role.ClientSecret)
+		gocloakClientMock.AssertExpectations(t)
+	})
+}
+
+func TestBackend_StaticRoleOfDeniedClient(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+
+	gocloakClientMock := mockedStaticRoleGocloak("somerealm", "myclient", "first123")
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	require.NoError(t, b.Setup(t.Context(), config))
+
+	connection := ConnectionConfig{
+		ServerUrl:    "http://auth.example.com",
+		Realm:        "master",
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+	}
+	require.NoError(t, writeConfig(t.Context(), config.StorageView, connection))
+
+	// the connection's own client cannot be taken over
+	resp, err := b.HandleRequest(t.Context(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "static-roles/vault",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"realm":           "master",
+			"client_id":       "vault",
+			"rotation_period": "1h",
+		},
+	})
+	require.ErrorIs(t, err, logical.ErrPermissionDenied)
+	require.True(t, resp.IsError())
+
+	resp, err = b.HandleRequest(t.Context(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "static-roles/app",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"realm":           "somerealm",
+			"client_id":       "myclient",
+			"rotation_period": "1h",
+		},
+	})
+	require.NoError(t, err)
+	require.Nil(t, resp)
+
+	// once the realm is no longer allowed, the stored secret is not served anymore
+	connection.AllowedRealms = []string{"otherrealm"}
+	require.NoError(t, writeConfig(t.Context(), config.StorageView, connection))
+	resp, err = b.HandleRequest(t.Context(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-creds/app",
+		Storage:   config.StorageView,
+	})
+	require.ErrorIs(t, err, logical.ErrPermissionDenied)
+	require.True(t, resp.IsError())
+
+	resp, err = b.HandleRequest(t.Context(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "static-roles/app",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"rotation_period": "2h",
+		},
+	})
+	require.ErrorIs(t, err, logical.ErrPermissionDenied)
+	require.True(t, resp.IsError())
+	gocloakClientMock.AssertNumberOfCalls(t, "RegenerateClientSecret", 1)
+}
+
+func TestBackend_StaticRoleRotationRegeneratesIfStoringFails(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		storage := &flakyPutStorage{prefix: staticRolesStoragePrefix}
+		config := logical.TestBackendConfig()
+		config.StorageView = storage
+		b, err := newBackend(config)
+		require.NoError(t, err)
+
+		gocloakClientMock := mockedStaticRoleGocloak("somerealm", "myclient", "first123", "second456", "third789")
+		b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+		require.NoError(t, b.Setup(t.Context(), config))
+
+		require.NoError(t, writeConfig(t.Context(), storage, ConnectionConfig{
+			ServerUrl:    "http://auth.example.com",
+			Realm:        "master",
+			ClientId:     "vault",
+			ClientSecret: "secret123",
+		}))
+		resp, err := b.HandleRequest(t.Context(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "static-roles/app",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"realm":           "somerealm",
+				"client_id":       "myclient",
+				"rotation_period": "1h",
+			},
+		})
+		require.NoError(t, err)
+		require.Nil(t, resp)
+
+		time.Sleep(time.Hour)
+		storage.failures = staticRoleWriteAttempts
+		err = b.periodicFunc(t.Context(), &logical.Request{Storage: storage})
+		require.ErrorContains(t, err, "client myclient in realm somerealm")
+
+		// the lost secret is replaced on the next run
+		require.NoError(t, b.periodicFunc(t.Context(), &logical.Request{Storage: storage}))
+		role, err := readStaticRole(t.Context(), storage, "app")
+		require.NoError(t, err)
+		require.Equal(t, "third789", role.ClientSecret)
+		gocloakClientMock.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,130 @@
+package keycloak
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathRealmTokenExchange(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "realms/" + framework.GenericNameRegex("realm") + "/token-exchange",
+		Fields: map[string]*framework.FieldSchema{
+			"realm": {
+				Type:        framework.TypeString,
+				Description: "Name of the realm.",
+			},
+			"subject_token": {
+				Type:        framework.TypeString,
+				Description: "Token to exchange.",
+			},
+			"client_id": {
+				Type:        framework.TypeString,
+				Description: "Client that performs the exchange. Defaults to the connection's client.",
+			},
+			"audience": {
+				Type:        framework.TypeString,
+				Description: "Client the exchanged token is meant for.",
+			},
+			"requested_token_type": {
+				Type:        framework.TypeString,
+				Description: "Type of the exchanged token, e.g. urn:ietf:params:oauth:token-type:access_token.",
+			},
+			"scope": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Scopes to request for the exchanged token.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRealmTokenExchangeUpdate,
+		},
+	}
+}
+
+func (b *backend) pathRealmTokenExchangeUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	realm := d.Get("realm").(string)
+	if realm == "" {
+		return logical.ErrorResponse("missing realm"), nil
+	}
+
+	config, err := readConfigForRequest(ctx, req.Storage, d, realm)
+	if err != nil {
+		return logical.ErrorResponse("failed to read config"), err
+	}
+	if config.ServerUrl == "" {
+		return logical.ErrorResponse("connection is not configured"), nil
+	}
+
+	subjectToken := d.Get("subject_token").(string)
+	clientId := d.Get("client_id").(string)
+	access := config.checkRealm(realm)
+	if clientId != "" {
+		access = config.checkClient(realm, clientId)
+	}
+	if access != nil {
+		return accessDenied(access)
+	}
+	// The access token of the connection's client is never exchanged, as
+	// that would hand out vault's own admin privileges.
+	if subjectToken == "" {
+		return logical.ErrorResponse("missing subject_token"), nil
+	}
+	// The connection's client only belongs to the realm of the connection.
+	if realm != config.Realm && clientId == "" {
+		return logical.ErrorResponse("missing client_id"), nil
+	}
+
+	options := keycloak.TokenOptions{
+		SubjectToken: &subjectToken,
+	}
+	if clientId != "" {
+		clientSecret, err := b.readClientSecretOfRealm(ctx, realm, clientId, config)
+		if err != nil {
+			return clientErrorResponse("could not retrieve client secret", err)
+		}
+		options.ClientID = &clientId
+		options.ClientSecret = &clientSecret
+	}
+	if audience := d.Get("audience").(string); audience != "" {
+		options.Audience = &audience
+	}
+	if requestedTokenType := d.Get("requested_token_type").(string); requestedTokenType != "" {
+		options.RequestedTokenType = &requestedTokenType
+	}
+	if scopes := d.Get("scope").([]string); len(scopes) > 0 {
+		options.Scopes = &scopes
+	}
+
+	goclaokClient, err := b.keycloakService(config)
+	if err != nil {
+		return logical.ErrorResponse("failed to access keycloak"), err
+	}
+	token, err := keycloak.Repeat(ctx, goclaokClient, func(service keycloak.Service) (*keycloak.JWT, error) {
+		// the connection's client authenticates anew for each attempt, as
+		// its client assertions must not be replayed
+		if clientId == "" {
+			if err := b.authenticate(ctx, config, &options); err != nil {
+				return nil, fmt.Errorf("could not authenticate the client of the connection: %w", err)
+			}
+		}
+		return service.ExchangeToken(ctx, realm, options)
+	})
+	if err != nil {
+		return logical.ErrorResponse("could not exchange token"), err
+	}
+
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"access_token": token.AccessToken,
+			"expires_in":   token.ExpiresIn,
+			"scope":        token.Scope,
+			"token_type":   token.TokenType,
+		},
+	}
+
+	return response, nil
+}
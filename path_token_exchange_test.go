@@ -0,0 +1,198 @@
+package keycloak
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBackend_TokenExchangeAsConnectionClient(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := &keycloak.MockService{}
+
+	clientId := "vault"
+	clientSecret := "secret123"
+	subjectToken := "workloadtoken"
+	audience := "target-service"
+	gocloakClientMock.On("ExchangeToken", mock.Anything, "somerealm", keycloak.TokenOptions{
+		ClientID:     &clientId,
+		ClientSecret: &clientSecret,
+		SubjectToken: &subjectToken,
+		Audience:     &audience,
+	}).Return(&keycloak.JWT{
+		AccessToken: "exchanged456",
+		ExpiresIn:   60,
+		Scope:       "profile",
+		TokenType:   "Bearer",
+	}, nil)
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "somerealm",
+		ServerUrl:    "http://example.com/auth",
+	})
+
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	exchangeReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "realms/somerealm/token-exchange",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"subject_token": "workloadtoken",
+			"audience":      "target-service",
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), exchangeReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	expectedResponse := map[string]interface{}{
+		"access_token": "exchanged456",
+		"expires_in":   60,
+		"scope":        "profile",
+		"token_type":   "Bearer",
+	}
+
+	if !reflect.DeepEqual(resp.Data, expectedResponse) {
+		t.Fatalf("Expected: %#v\nActual: %#v", expectedResponse, resp.Data)
+	}
+}
+
+func TestBackend_TokenExchangeOfSubjectTokenAsClient(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := &keycloak.MockService{}
+
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	requestedClientId := "exchanger"
+	idOfRequestedClient := "123"
+	gocloakClientMock.On("GetClients", mock.Anything, "access123", "otherrealm", keycloak.GetClientsParams{
+		ClientID: &requestedClientId,
+	}).Return([]*keycloak.Client{
+		{
+			ID: &idOfRequestedClient,
+		},
+	}, nil)
+	secretValue := "exchangersecret"
+	gocloakClientMock.On("GetClientSecret", mock.Anything, "access123", "otherrealm", idOfRequestedClient).Return(&keycloak.CredentialRepresentation{
+		Value: &secretValue,
+	}, nil)
+	subjectToken := "workloadtoken"
+	audience := "target-service"
+	requestedTokenType := "urn:ietf:params:oauth:token-type:access_token"
+	scopes := []string{"profile"}
+	gocloakClientMock.On("ExchangeToken", mock.Anything, "otherrealm", keycloak.TokenOptions{
+		ClientID:           &requestedClientId,
+		ClientSecret:       &secretValue,
+		SubjectToken:       &subjectToken,
+		Audience:           &audience,
+		RequestedTokenType: &requestedTokenType,
+		Scopes:             &scopes,
+	}).Return(&keycloak.JWT{
+		AccessToken: "exchanged456",
+		ExpiresIn:   60,
+		Scope:       "profile",
+		TokenType:   "Bearer",
+	}, nil)
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "master",
+		ServerUrl:    "http://example.com/auth",
+	})
+
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	exchangeReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "realms/otherrealm/token-exchange",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"subject_token":        "workloadtoken",
+			"client_id":            "exchanger",
+			"audience":             "target-service",
+			"requested_token_type": "urn:ietf:params:oauth:token-type:access_token",
+			"scope":                "profile",
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), exchangeReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	if resp.Data["access_token"] != "exchanged456" {
+		t.Fatalf("unexpected response %#v", resp.Data)
+	}
+}
+
+func TestBackend_TokenExchangeRequiresSubjectToken(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gocloakClientMock := &keycloak.MockService{}
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "master",
+		ServerUrl:    "http://example.com/auth",
+	})
+
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	// the token of the connection's client must not be exchanged, not even in its own realm
+	for _, realm := range []string{"master", "otherrealm"} {
+		exchangeReq := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "realms/" + realm + "/token-exchange",
+			Storage:   config.StorageView,
+			Data: map[string]interface{}{
+				"client_id": "exchanger",
+			},
+		}
+		resp, err := b.HandleRequest(context.Background(), exchangeReq)
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+		}
+	}
+	gocloakClientMock.AssertNotCalled(t, "LoginClient", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	gocloakClientMock.AssertNotCalled(t, "ExchangeToken", mock.Anything, mock.Anything, mock.Anything)
+}
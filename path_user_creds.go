@@ -0,0 +1,207 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/base62"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	secretTypeUser = "keycloak_user"
+
+	generatedPasswordLength = 32
+)
+
+func pathUserCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "user-creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the user role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathUserCredsRead,
+		},
+	}
+}
+
+func secretUser(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: secretTypeUser,
+		Fields: map[string]*framework.FieldSchema{
+			"username": {
+				Type:        framework.TypeString,
+				Description: "Username of the created user",
+			},
+			"password": {
+				Type:        framework.TypeString,
+				Description: "Password of the created user",
+			},
+		},
+
+		Renew:  b.secretUserRenew,
+		Revoke: b.secretUserRevoke,
+	}
+}
+
+func (b *backend) pathUserCredsRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	role, err := readDynamicUserRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse("unknown user role: %s", name), nil
+	}
+
+	config, err := readConfigForRealm(ctx, req.Storage, role.Realm)
+	if err != nil {
+		return logical.ErrorResponse("failed to read config"), err
+	}
+	if err := config.checkRealm(role.Realm); err != nil {
+		return accessDenied(err)
+	}
+	// the connection's restrictions may have changed since the role was written
+	if err := config.checkClientRoles(role.Realm, role.ClientRoles); err != nil {
+		return accessDenied(err)
+	}
+
+	goclaokClient, token, err := b.getClientAndAccessToken(ctx, config)
+	if err != nil {
+		return logical.ErrorResponse("failed to access keycloak"), err
+	}
+
+	suffix, err := base62.Random(12)
+	if err != nil {
+		return nil, err
+	}
+	username := fmt.Sprintf("vault-%s-%s", name, strings.ToLower(suffix))
+
+	password, err := base62.Random(generatedPasswordLength)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := createDynamicUser(ctx, goclaokClient, token, username, role)
+	if err != nil {
+		return logical.ErrorResponse("could not create user"), err
+	}
+
+	if err := setupDynamicUser(ctx, goclaokClient, token, userID, password, role); err != nil {
+		// do not leave a half configured user behind
+		if deleteErr := goclaokClient.DeleteUser(ctx, token.AccessToken, role.Realm, userID); deleteErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to delete user %s: %w", username, deleteErr))
+		}
+		return logical.ErrorResponse("could not set up user"), err
+	}
+
+	response := b.Secret(secretTypeUser).Response(map[string]interface{}{
+		"username": username,
+		"password": password,
+	}, map[string]interface{}{
+		"role":     name,
+		"realm":    role.Realm,
+		"username": username,
+		"user_id":  userID,
+	})
+	response.Secret.TTL = role.TTL
+	response.Secret.MaxTTL = role.MaxTTL
+
+	return response, nil
+}
+
+func createDynamicUser(ctx context.Context, goclaokClient keycloak.Service, token *keycloak.JWT, username string, role *dynamicUserRole) (string, error) {
+	enabled := true
+	user := keycloak.User{
+		Username: &username,
+		Enabled:  &enabled,
+	}
+	if len(role.Attributes) > 0 {
+		attributes := make(map[string][]string, len(role.Attributes))
+		for key, value := range role.Attributes {
+			attributes[key] = []string{value}
+		}
+		user.Attributes = &attributes
+	}
+
+	return goclaokClient.CreateUser(ctx, token.AccessToken, role.Realm, user)
+}
+
+// setupDynamicUser sets the password of the freshly created user, lets it
+// join the groups and grants the roles of the user role.
+func setupDynamicUser(ctx context.Context, goclaokClient keycloak.Service, token *keycloak.JWT, userID string, password string, role *dynamicUserRole) error {
+	if err := goclaokClient.SetPassword(ctx, token.AccessToken, userID, role.Realm, password, false); err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+
+	for _, groupPath := range role.Groups {
+		if !strings.HasPrefix(groupPath, "/") {
+			groupPath = "/" + groupPath
+		}
+		group, err := goclaokClient.GetGroupByPath(ctx, token.AccessToken, role.Realm, groupPath)
+		if err != nil {
+			return fmt.Errorf("failed to get group %s: %w", groupPath, err)
+		}
+		if err := goclaokClient.AddUserToGroup(ctx, token.AccessToken, role.Realm, userID, *group.ID); err != nil {
+			return fmt.Errorf("failed to add user to group %s: %w", groupPath, err)
+		}
+	}
+
+	return grantRoles(ctx, goclaokClient, token, role.Realm, userID, role.RealmRoles, role.ClientRoles)
+}
+
+func (b *backend) secretUserRenew(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name, ok := req.Secret.InternalData["role"].(string)
+	if !ok {
+		return nil, errors.New("secret is missing role internal data")
+	}
+	role, err := readDynamicUserRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("user role %s does not exist anymore", name)
+	}
+
+	response := &logical.Response{Secret: req.Secret}
+	response.Secret.TTL = role.TTL
+	response.Secret.MaxTTL = role.MaxTTL
+	return response, nil
+}
+
+func (b *backend) secretUserRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	realm, ok := req.Secret.InternalData["realm"].(string)
+	if !ok {
+		return nil, errors.New("secret is missing realm internal data")
+	}
+	userID, ok := req.Secret.InternalData["user_id"].(string)
+	if !ok {
+		return nil, errors.New("secret is missing user_id internal data")
+	}
+
+	config, err := readConfigForRealm(ctx, req.Storage, realm)
+	if err != nil {
+		return nil, err
+	}
+
+	goclaokClient, token, err := b.getClientAndAccessToken(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = goclaokClient.DeleteUser(ctx, token.AccessToken, realm, userID)
+	if err != nil && !keycloak.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to delete user %v: %w", req.Secret.InternalData["username"], err)
+	}
+
+	return nil, nil
+}
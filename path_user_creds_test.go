@@ -0,0 +1,163 @@
+package keycloak
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Serviceware/vault-plugin-secrets-keycloak/keycloak"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBackend_ReadUserCredsAndRevoke(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+
+	userId := "user123"
+	gocloakClientMock.On("CreateUser", mock.Anything, "access123", "somerealm", mock.MatchedBy(func(user keycloak.User) bool {
+		return strings.HasPrefix(*user.Username, "vault-tester-") &&
+			*user.Enabled &&
+			reflect.DeepEqual(*user.Attributes, map[string][]string{"department": {"qa"}})
+	})).Return(userId, nil)
+	var password string
+	gocloakClientMock.On("SetPassword", mock.Anything, "access123", userId, "somerealm", mock.Anything, false).Run(func(args mock.Arguments) {
+		password = args.String(4)
+	}).Return(nil)
+	groupId := "group123"
+	gocloakClientMock.On("GetGroupByPath", mock.Anything, "access123", "somerealm", "/testers").Return(&keycloak.Group{
+		ID: &groupId,
+	}, nil)
+	gocloakClientMock.On("AddUserToGroup", mock.Anything, "access123", "somerealm", userId, groupId).Return(nil)
+	realmRoleName := "offline_access"
+	gocloakClientMock.On("GetRealmRole", mock.Anything, "access123", "somerealm", realmRoleName).Return(&keycloak.Role{
+		Name: &realmRoleName,
+	}, nil)
+	gocloakClientMock.On("AddRealmRoleToUser", mock.Anything, "access123", "somerealm", userId, []keycloak.Role{{Name: &realmRoleName}}).Return(nil)
+	gocloakClientMock.On("DeleteUser", mock.Anything, "access123", "somerealm", userId).Return(nil)
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "master",
+		ServerUrl:    "http://example.com/auth",
+	})
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "user-roles/tester",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"realm":       "somerealm",
+			"groups":      "testers",
+			"realm_roles": "offline_access",
+			"attributes":  map[string]interface{}{"department": "qa"},
+			"ttl":         "1h",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user-creds/tester",
+		Storage:   config.StorageView,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	if !strings.HasPrefix(resp.Data["username"].(string), "vault-tester-") {
+		t.Fatalf("unexpected username %v", resp.Data["username"])
+	}
+	if password == "" || resp.Data["password"] != password {
+		t.Fatalf("expected password %q to be set, got %v", password, resp.Data["password"])
+	}
+	if resp.Secret == nil || resp.Secret.TTL != time.Hour {
+		t.Fatalf("expected a lease of 1h, got %#v", resp.Secret)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   config.StorageView,
+		Secret:    resp.Secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+	gocloakClientMock.AssertCalled(t, "DeleteUser", mock.Anything, "access123", "somerealm", userId)
+}
+
+func TestBackend_ReadUserCredsDeletesUserIfSetupFails(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gocloakClientMock := &keycloak.MockService{}
+	gocloakClientMock.On("LoginClient", mock.Anything, "vault", "secret123", "master").Return(&keycloak.JWT{
+		AccessToken: "access123",
+	}, nil)
+	userId := "user123"
+	gocloakClientMock.On("CreateUser", mock.Anything, "access123", "somerealm", mock.Anything).Return(userId, nil)
+	gocloakClientMock.On("SetPassword", mock.Anything, "access123", userId, "somerealm", mock.Anything, false).Return(errors.New("400 invalidPasswordMinLengthMessage"))
+	gocloakClientMock.On("DeleteUser", mock.Anything, "access123", "somerealm", userId).Return(nil)
+
+	b.KeycloakServiceFactory = keycloak.MockServiceFactoryFunc(gocloakClientMock)
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "master",
+		ServerUrl:    "http://example.com/auth",
+	})
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "user-roles/tester",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"realm": "somerealm",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user-creds/tester",
+		Storage:   config.StorageView,
+	})
+	if err == nil || (resp == nil || !resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+	gocloakClientMock.AssertCalled(t, "DeleteUser", mock.Anything, "access123", "somerealm", userId)
+}
@@ -0,0 +1,195 @@
+package keycloak
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const userRolesStoragePrefix = "user-roles/"
+
+func pathUserRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "user-roles/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathUserRolesList,
+		},
+	}
+}
+
+func pathUserRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "user-roles/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"realm": {
+				Type:        framework.TypeString,
+				Description: "Name of the realm in which the users are created",
+			},
+			"groups": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Paths of the groups the created users join, e.g. /testers",
+			},
+			"realm_roles": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Realm roles that are granted to the created users",
+			},
+			"client_roles": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Client roles that are granted to the created users, each in the form <client-id>/<role>",
+			},
+			"attributes": {
+				Type:        framework.TypeKVPairs,
+				Description: "Attributes that are set on the created users",
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Default lease duration of the created users",
+			},
+			"max_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum lease duration of the created users",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathUserRoleUpdate,
+			logical.ReadOperation:   b.pathUserRoleRead,
+			logical.DeleteOperation: b.pathUserRoleDelete,
+		},
+	}
+}
+
+func (b *backend) pathUserRolesList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List(ctx, userRolesStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathUserRoleUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("missing name"), nil
+	}
+
+	role, err := readDynamicUserRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &dynamicUserRole{}
+	}
+
+	if realm, ok := d.GetOk("realm"); ok {
+		role.Realm = realm.(string)
+	}
+	if role.Realm == "" {
+		return logical.ErrorResponse("missing realm"), nil
+	}
+	if groups, ok := d.GetOk("groups"); ok {
+		role.Groups = groups.([]string)
+	}
+	if realmRoles, ok := d.GetOk("realm_roles"); ok {
+		role.RealmRoles = realmRoles.([]string)
+	}
+	if clientRoles, ok := d.GetOk("client_roles"); ok {
+		role.ClientRoles = clientRoles.([]string)
+	}
+	if err := validateClientRoles(role.ClientRoles); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	config, err := readConfigForRealm(ctx, req.Storage, role.Realm)
+	if err != nil {
+		return logical.ErrorResponse("failed to read config"), err
+	}
+	if err := config.checkClientRoles(role.Realm, role.ClientRoles); err != nil {
+		return accessDenied(err)
+	}
+	if attributes, ok := d.GetOk("attributes"); ok {
+		role.Attributes = attributes.(map[string]string)
+	}
+	if ttl, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttl.(int)) * time.Second
+	}
+	if maxTTL, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(maxTTL.(int)) * time.Second
+	}
+	if role.MaxTTL > 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl must not be greater than max_ttl"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(userRolesStoragePrefix+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathUserRoleRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := readDynamicUserRole(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"realm":        role.Realm,
+			"groups":       role.Groups,
+			"realm_roles":  role.RealmRoles,
+			"client_roles": role.ClientRoles,
+			"attributes":   role.Attributes,
+			"ttl":          int64(role.TTL.Seconds()),
+			"max_ttl":      int64(role.MaxTTL.Seconds()),
+		},
+	}
+	return response, nil
+}
+
+func (b *backend) pathUserRoleDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete(ctx, userRolesStoragePrefix+d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func readDynamicUserRole(ctx context.Context, storage logical.Storage, name string) (*dynamicUserRole, error) {
+	entry, err := storage.Get(ctx, userRolesStoragePrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var role dynamicUserRole
+	if err := entry.DecodeJSON(&role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// dynamicUserRole is a template for the users that are created when reading user-creds/:name.
+type dynamicUserRole struct {
+	Realm       string            `json:"realm"`
+	Groups      []string          `json:"groups"`
+	RealmRoles  []string          `json:"realm_roles"`
+	ClientRoles []string          `json:"client_roles"`
+	Attributes  map[string]string `json:"attributes"`
+	TTL         time.Duration     `json:"ttl"`
+	MaxTTL      time.Duration     `json:"max_ttl"`
+}
@@ -0,0 +1,99 @@
+package keycloak
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestBackend_UserRoles(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Setup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	// account is denied by default
+	writeConfig(context.Background(), config.StorageView, ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "master",
+		ServerUrl:    "http://example.com/auth",
+		AccessConfig: AccessConfig{DeniedClientIds: []string{}},
+	})
+
+	writeReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "user-roles/tester",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"realm":        "somerealm",
+			"groups":       "/testers",
+			"realm_roles":  "offline_access",
+			"client_roles": "account/view-profile",
+			"attributes":   map[string]interface{}{"department": "qa"},
+			"ttl":          "1h",
+		},
+	}
+	resp, err = b.HandleRequest(context.Background(), writeReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	readReq := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "user-roles/tester",
+		Storage:   config.StorageView,
+	}
+	resp, err = b.HandleRequest(context.Background(), readReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	expectedRoleData := map[string]interface{}{
+		"realm":        "somerealm",
+		"groups":       []string{"/testers"},
+		"realm_roles":  []string{"offline_access"},
+		"client_roles": []string{"account/view-profile"},
+		"attributes":   map[string]string{"department": "qa"},
+		"ttl":          int64(3600),
+		"max_ttl":      int64(0),
+	}
+	if !reflect.DeepEqual(resp.Data, expectedRoleData) {
+		t.Fatalf("Expected: %#v\nActual: %#v", expectedRoleData, resp.Data)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "user-roles/",
+		Storage:   config.StorageView,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"tester"}) {
+		t.Fatalf("Expected: %#v\nActual: %#v", []string{"tester"}, resp.Data["keys"])
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "user-roles/tester",
+		Storage:   config.StorageView,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), readReq)
+	if err != nil || resp != nil {
+		t.Fatalf("bad: resp: %#v\nerr:%s", resp, err)
+	}
+}
@@ -0,0 +1,62 @@
+package keycloak
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// sealWrapMigrationKey marks that the entries below sealWrappedStorage were
+// rewritten, so that they are seal wrapped even if they were stored before.
+const sealWrapMigrationKey = "migrations/seal-wrap"
+
+// sealWrappedStorage lists the storage keys that hold credentials. Entries
+// ending with a slash are prefixes.
+var sealWrappedStorage = []string{
+	legacyDefaultStorageKey,
+	"config/connections/",
+	"config/realms/",
+	"static-roles/",
+}
+
+func isSealWrapped(key string) bool {
+	for _, wrapped := range sealWrappedStorage {
+		if key == wrapped || strings.HasSuffix(wrapped, "/") && strings.HasPrefix(key, wrapped) {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateSealWrap rewrites the credential-bearing entries once, as vault only
+// seal wraps entries when they are written.
+func migrateSealWrap(ctx context.Context, storage logical.Storage) error {
+	done, err := storage.Get(ctx, sealWrapMigrationKey)
+	if err != nil || done != nil {
+		return err
+	}
+
+	keys, err := logical.CollectKeys(ctx, storage)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if !isSealWrapped(key) {
+			continue
+		}
+		entry, err := storage.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+		if err := storage.Put(ctx, &logical.StorageEntry{Key: key, Value: entry.Value}); err != nil {
+			return fmt.Errorf("failed to rewrite %s: %w", key, err)
+		}
+	}
+
+	return storage.Put(ctx, &logical.StorageEntry{Key: sealWrapMigrationKey, Value: []byte("{}")})
+}
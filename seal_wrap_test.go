@@ -0,0 +1,84 @@
+package keycloak
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+// putRecordingStorage records the keys that are written.
+type putRecordingStorage struct {
+	logical.InmemStorage
+	puts []string
+}
+
+func (s *putRecordingStorage) Put(ctx context.Context, entry *logical.StorageEntry) error {
+	s.puts = append(s.puts, entry.Key)
+	return s.InmemStorage.Put(ctx, entry)
+}
+
+func TestBackend_SealWrapStorage(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(context.Background(), config))
+
+	for _, key := range []string{
+		"config/connection",
+		"config/connections/default",
+		"config/connections/staging",
+		"config/realms/realm123/connection",
+		"static-roles/my-app",
+	} {
+		require.Truef(t, isSealWrapped(key), "%s should be seal wrapped", key)
+	}
+	for _, key := range []string{
+		"roles/ci",
+		"user-roles/tester",
+		"config/connectionfoo",
+	} {
+		require.Falsef(t, isSealWrapped(key), "%s should not be seal wrapped", key)
+	}
+	require.Equal(t, sealWrappedStorage, b.SpecialPaths().SealWrapStorage)
+}
+
+func TestBackend_MigrateSealWrap(t *testing.T) {
+	ctx := context.Background()
+	storage := &putRecordingStorage{}
+	config := logical.TestBackendConfig()
+	config.StorageView = storage
+	b, err := newBackend(config)
+	require.NoError(t, err)
+	require.NoError(t, b.Setup(ctx, config))
+
+	realmConfig := ConnectionConfig{
+		ClientId:     "vault",
+		ClientSecret: "secret123",
+		Realm:        "realm123",
+		ServerUrl:    "http://example.com/auth",
+	}
+	require.NoError(t, writeConfigForKey(ctx, storage, realmConfig, "config/realms/realm123/connection"))
+	require.NoError(t, storage.InmemStorage.Put(ctx, &logical.StorageEntry{Key: "static-roles/my-app", Value: []byte(`{"client_id":"my-client"}`)}))
+	require.NoError(t, storage.InmemStorage.Put(ctx, &logical.StorageEntry{Key: "roles/ci", Value: []byte(`{"realm":"realm123"}`)}))
+	storage.puts = nil
+
+	require.NoError(t, b.Initialize(ctx, &logical.InitializationRequest{Storage: storage}))
+
+	require.ElementsMatch(t, []string{
+		"config/realms/realm123/connection",
+		"static-roles/my-app",
+		"migrations/seal-wrap",
+	}, storage.puts)
+
+	actualConfig, err := readConfigForKey(ctx, storage, "config/realms/realm123/connection")
+	require.NoError(t, err)
+	require.Equal(t, realmConfig, actualConfig)
+
+	// the entries are rewritten only once
+	storage.puts = nil
+	require.NoError(t, b.Initialize(ctx, &logical.InitializationRequest{Storage: storage}))
+	require.Empty(t, storage.puts)
+}